@@ -0,0 +1,89 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package adb
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+var NoDisplayInfoError = errors.New("failed to parse display info")
+
+// DisplayInfo is the display of the device in its natural orientation
+type DisplayInfo struct {
+	Width    int
+	Height   int
+	Density  int
+	Rotation int // 0 ~ 3, quarter turns counter-clockwise
+}
+
+var (
+	sizePattern     = regexp.MustCompile(`(Physical|Override) size: (\d+)x(\d+)`)
+	densityPattern  = regexp.MustCompile(`(Physical|Override) density: (\d+)`)
+	rotationPattern = regexp.MustCompile(`(?:SurfaceOrientation: |orientation=)(\d)`)
+)
+
+// lastMatch returns the submatches of the last match, override values come after the physical ones
+func lastMatch(pattern *regexp.Regexp, text string) []string {
+	matches := pattern.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[len(matches)-1]
+}
+
+func parseDisplaySize(text string) (int, int, error) {
+	m := lastMatch(sizePattern, text)
+	if m == nil {
+		return 0, 0, NoDisplayInfoError
+	}
+
+	width, _ := strconv.Atoi(m[2])
+	height, _ := strconv.Atoi(m[3])
+	return width, height, nil
+}
+
+func parseDisplayDensity(text string) (int, error) {
+	m := lastMatch(densityPattern, text)
+	if m == nil {
+		return 0, NoDisplayInfoError
+	}
+
+	return strconv.Atoi(m[2])
+}
+
+func parseDisplayRotation(text string) (int, error) {
+	m := rotationPattern.FindStringSubmatch(text)
+	if m == nil {
+		return 0, NoDisplayInfoError
+	}
+
+	return strconv.Atoi(m[1])
+}
+
+// DisplayInfo queries `wm size`, `wm density` and the rotation of the built-in display.
+// Only the size is mandatory, density and rotation are left zero if they are unavailable.
+func (d *Device) DisplayInfo() (*DisplayInfo, error) {
+	result, err := d.Sh("wm", "size")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DisplayInfo{}
+	info.Width, info.Height, err = parseDisplaySize(result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result, err := d.Sh("wm", "density"); err == nil {
+		info.Density, _ = parseDisplayDensity(result)
+	}
+
+	if result, err := d.Sh("dumpsys", "input"); err == nil {
+		info.Rotation, _ = parseDisplayRotation(result)
+	}
+
+	return info, nil
+}
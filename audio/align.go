@@ -0,0 +1,144 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	alignWindow = 500  // hops of captured audio compared with the reference, 5 seconds
+	keepWindow  = 3000 // hops of captured audio kept, 30 seconds
+
+	MinScore  = 0.4  // correlation of a trustworthy alignment, clicks never match the music well
+	MinMargin = 0.15 // how much the best alignment has to beat the others
+
+	peakWidth = 10 // hops around the best lag that belong to the same peak
+)
+
+// Correlate finds the lag of signal against ref, i.e. signal[i] ~ ref[i-lag], for lag in [minLag, maxLag].
+// ref is zero outside of its range, score is the Pearson correlation of the best lag,
+// and margin is how much it beats the best lag outside of its peak.
+func Correlate(signal, ref []float64, minLag, maxLag int) (lag int, score, margin float64) {
+	n := float64(len(signal))
+	sumS, sumSS := 0.0, 0.0
+	for _, s := range signal {
+		sumS += s
+		sumSS += s * s
+	}
+	varS := sumSS - sumS*sumS/n
+	if len(signal) == 0 || varS <= 0 || maxLag < minLag {
+		return 0, 0, 0
+	}
+
+	scores := make([]float64, maxLag-minLag+1)
+	for l := minLag; l <= maxLag; l++ {
+		sumR, sumRR, sumSR := 0.0, 0.0, 0.0
+		for i := max(l, 0); i < min(len(ref)+l, len(signal)); i++ {
+			r := ref[i-l]
+			sumR += r
+			sumRR += r * r
+			sumSR += signal[i] * r
+		}
+
+		varR := sumRR - sumR*sumR/n
+		if varR <= 0 {
+			continue
+		}
+		scores[l-minLag] = (sumSR - sumS*sumR/n) / math.Sqrt(varS*varR)
+	}
+
+	best := 0
+	for i, s := range scores {
+		if s > scores[best] {
+			best = i
+		}
+	}
+
+	second := 0.0
+	for i, s := range scores {
+		if i < best-peakWidth || i > best+peakWidth {
+			second = max(second, s)
+		}
+	}
+
+	return best + minLag, scores[best], scores[best] - second
+}
+
+// Alignment is where the reference starts in the captured audio
+type Alignment struct {
+	Start  time.Duration // in the timestamps of the captured audio
+	Score  float64
+	Margin float64
+}
+
+// Confident reports whether the alignment is trustworthy
+func (a Alignment) Confident() bool {
+	return a.Score >= MinScore && a.Margin >= MinMargin
+}
+
+// Aligner aligns a stream of captured audio with a reference envelope,
+// which is the envelope of the song audio or the click track of the chart.
+type Aligner struct {
+	reference []float64
+
+	envelope *OnsetEnvelope
+	rate     int
+	live     []float64
+	start    time.Duration // timestamp of live[0]
+	next     time.Duration // expected timestamp of the next samples
+}
+
+func NewAligner(reference []float64) *Aligner {
+	return &Aligner{
+		reference: reference,
+	}
+}
+
+// Write appends captured samples, pts being the timestamp of the first one.
+// The stream starts over when the samples are not contiguous.
+func (a *Aligner) Write(pts time.Duration, sampleRate int, samples []float32) {
+	const tolerance = 5 * time.Millisecond
+
+	if a.envelope == nil || sampleRate != a.rate || pts < a.next-tolerance || pts > a.next+tolerance {
+		a.envelope = NewOnsetEnvelope(sampleRate)
+		a.rate = sampleRate
+		a.live = a.live[:0]
+		a.start = pts
+	}
+
+	a.envelope.Write(samples)
+	a.live = append(a.live, a.envelope.Take()...)
+	a.next = pts + time.Duration(len(samples))*time.Second/time.Duration(sampleRate)
+
+	if drop := len(a.live) - keepWindow; drop > 0 {
+		a.live = append(a.live[:0], a.live[drop:]...)
+		a.start += time.Duration(drop) * Hop
+	}
+}
+
+// Duration is the length of the captured audio kept
+func (a *Aligner) Duration() time.Duration {
+	return time.Duration(len(a.live)) * Hop
+}
+
+// Align aligns the latest captured audio with the reference.
+// It does not before enough audio is captured.
+func (a *Aligner) Align() (Alignment, bool) {
+	if len(a.live) < alignWindow {
+		return Alignment{}, false
+	}
+
+	offset := len(a.live) - alignWindow
+	window := a.live[offset:]
+	// the window may be anywhere from before the reference starts to its end
+	lag, score, margin := Correlate(window, a.reference, -len(a.reference)+peakWidth, alignWindow-peakWidth)
+
+	return Alignment{
+		Start:  a.start + time.Duration(offset+lag)*Hop,
+		Score:  score,
+		Margin: margin,
+	}, true
+}
@@ -0,0 +1,118 @@
+package audio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvarenzn/ssm/audio"
+)
+
+const tolerance = 20 * time.Millisecond
+
+func load(t *testing.T, name string) *audio.Clip {
+	t.Helper()
+
+	clip, err := audio.LoadWAV("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", name, err)
+	}
+	return clip
+}
+
+// feed writes the clip to the aligner in 20ms packets, like the device does
+func feed(aligner *audio.Aligner, clip *audio.Clip) {
+	packet := clip.SampleRate / 50
+	for i := 0; i < len(clip.Samples); i += packet {
+		pts := time.Duration(i) * time.Second / time.Duration(clip.SampleRate)
+		aligner.Write(pts, clip.SampleRate, clip.Samples[i:min(i+packet, len(clip.Samples))])
+	}
+}
+
+func TestReadWAV(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		rate    int
+		samples int
+	}{
+		{"song.wav", 8000, 6 * 8000},
+		{"capture.wav", 11025, 7 * 11025},
+		{"clicks.wav", 8000, 8 * 8000},
+	} {
+		clip := load(t, tc.name)
+		if clip.SampleRate != tc.rate || len(clip.Samples) != tc.samples {
+			t.Errorf("%s: got %d samples at %d Hz, want %d at %d Hz", tc.name, len(clip.Samples), clip.SampleRate, tc.samples, tc.rate)
+		}
+	}
+}
+
+func TestAlignSong(t *testing.T) {
+	song := load(t, "song.wav")
+	capture := load(t, "capture.wav")
+
+	aligner := audio.NewAligner(song.Envelope())
+	feed(aligner, capture)
+
+	alignment, ok := aligner.Align()
+	if !ok {
+		t.Fatal("Not enough audio to align")
+	}
+
+	want := 1370 * time.Millisecond
+	if d := alignment.Start - want; d < -tolerance || d > tolerance {
+		t.Errorf("Song starts at %v, want %v", alignment.Start, want)
+	}
+	if !alignment.Confident() {
+		t.Errorf("Alignment not confident: score %.2f, margin %.2f", alignment.Score, alignment.Margin)
+	}
+}
+
+func TestAlignClickTrack(t *testing.T) {
+	notes := []float64{0.5, 0.75, 1.25, 1.375, 2, 2.5, 2.625, 3.125, 3.5, 4.25, 4.5, 4.625, 5.25, 5.75, 6, 6.875}
+	times := make([]time.Duration, len(notes))
+	for i, n := range notes {
+		times[i] = time.Duration(n * float64(time.Second))
+	}
+
+	aligner := audio.NewAligner(audio.ClickTrack(times))
+	feed(aligner, load(t, "clicks.wav"))
+
+	alignment, ok := aligner.Align()
+	if !ok {
+		t.Fatal("Not enough audio to align")
+	}
+
+	want := 850 * time.Millisecond
+	if d := alignment.Start - want; d < -tolerance || d > tolerance {
+		t.Errorf("Chart starts at %v, want %v", alignment.Start, want)
+	}
+	if !alignment.Confident() {
+		t.Errorf("Alignment not confident: score %.2f, margin %.2f", alignment.Score, alignment.Margin)
+	}
+}
+
+func TestAlignUnrelated(t *testing.T) {
+	song := load(t, "song.wav")
+
+	// the clicks have nothing to do with the song
+	aligner := audio.NewAligner(song.Envelope())
+	feed(aligner, load(t, "clicks.wav"))
+
+	alignment, ok := aligner.Align()
+	if !ok {
+		t.Fatal("Not enough audio to align")
+	}
+	if alignment.Confident() {
+		t.Errorf("Unrelated audio aligned at %v: score %.2f, margin %.2f", alignment.Start, alignment.Score, alignment.Margin)
+	}
+}
+
+func TestAlignTooShort(t *testing.T) {
+	song := load(t, "song.wav")
+	song.Samples = song.Samples[:2*song.SampleRate]
+
+	aligner := audio.NewAligner(song.Envelope())
+	feed(aligner, song)
+	if _, ok := aligner.Align(); ok {
+		t.Error("Aligned with 2 seconds of audio")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// Hop is the time step of onset envelopes
+const Hop = 10 * time.Millisecond
+
+// energy below this (about -60 dB) is silence, so that noise in silence does not make onsets
+const energyFloor = 1e-6
+
+// OnsetEnvelope computes the onset strength of a stream of samples, one value per Hop:
+// how much the loudness rises, in log scale so that it does not depend on the volume.
+type OnsetEnvelope struct {
+	hopSize  int
+	sum      float64
+	count    int
+	previous float64
+	values   []float64
+}
+
+func NewOnsetEnvelope(sampleRate int) *OnsetEnvelope {
+	return &OnsetEnvelope{
+		hopSize:  max(sampleRate*int(Hop/time.Microsecond)/1e6, 1),
+		previous: math.Log(energyFloor),
+	}
+}
+
+func (e *OnsetEnvelope) Write(samples []float32) {
+	for _, s := range samples {
+		e.sum += float64(s) * float64(s)
+		e.count++
+		if e.count < e.hopSize {
+			continue
+		}
+
+		loudness := math.Log(e.sum/float64(e.count) + energyFloor)
+		e.values = append(e.values, max(loudness-e.previous, 0))
+		e.previous = loudness
+		e.sum, e.count = 0, 0
+	}
+}
+
+// Values returns the envelope so far, the caller may keep or truncate it with Take
+func (e *OnsetEnvelope) Values() []float64 {
+	return e.values
+}
+
+// Take returns the envelope so far and starts a new one
+func (e *OnsetEnvelope) Take() []float64 {
+	values := e.values
+	e.values = nil
+	return values
+}
+
+// Envelope returns the onset envelope of the whole clip
+func (c *Clip) Envelope() []float64 {
+	e := NewOnsetEnvelope(c.SampleRate)
+	e.Write(c.Samples)
+	return e.Values()
+}
+
+// ClickTrack returns the envelope of a click at each of times, e.g. the notes of a chart.
+// Clicks are blurred by a few hops, as the music does not hit exactly on the notes.
+func ClickTrack(times []time.Duration) []float64 {
+	const sigma = 2.0 // in hops
+
+	end := time.Duration(0)
+	for _, t := range times {
+		end = max(end, t)
+	}
+
+	track := make([]float64, int(end/Hop)+1+int(3*sigma))
+	for _, t := range times {
+		if t < 0 {
+			continue
+		}
+
+		center := float64(t) / float64(Hop)
+		for i := max(int(center-3*sigma), 0); i < min(int(center+3*sigma)+1, len(track)); i++ {
+			d := (float64(i) - center) / sigma
+			track[i] = max(track[i], math.Exp(-d*d/2))
+		}
+	}
+
+	return track
+}
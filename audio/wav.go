@@ -0,0 +1,132 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+var (
+	ErrInvalidWAV     = errors.New("invalid WAV file")
+	ErrUnsupportedWAV = errors.New("unsupported WAV format, only 16/24/32-bit PCM and 32-bit float are supported")
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// Clip is a mono audio clip
+type Clip struct {
+	SampleRate int
+	Samples    []float32 // -1 ~ 1
+}
+
+// ReadWAV reads a WAV file, the channels are mixed down to mono
+func ReadWAV(r io.Reader) (*Clip, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return nil, ErrInvalidWAV
+	}
+
+	var format, channels, bits uint16
+	var rate uint32
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if err == io.EOF {
+				return nil, ErrInvalidWAV
+			}
+			return nil, err
+		}
+
+		size := binary.LittleEndian.Uint32(chunk[4:])
+		data := make([]byte, size+size%2) // chunks are padded to even sizes
+		if _, err := io.ReadFull(r, data); err != nil && !(string(chunk[:4]) == "data" && err == io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		data = data[:size]
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrInvalidWAV
+			}
+
+			format = binary.LittleEndian.Uint16(data)
+			channels = binary.LittleEndian.Uint16(data[2:])
+			rate = binary.LittleEndian.Uint32(data[4:])
+			bits = binary.LittleEndian.Uint16(data[14:])
+			if format == wavFormatExtensible && size >= 26 {
+				format = binary.LittleEndian.Uint16(data[24:]) // sub format GUID
+			}
+		case "data":
+			if channels == 0 || rate == 0 {
+				return nil, ErrInvalidWAV
+			}
+			return decodeWAVSamples(data, format, int(channels), int(bits), int(rate))
+		}
+	}
+}
+
+func decodeWAVSamples(data []byte, format uint16, channels, bits, rate int) (*Clip, error) {
+	var sample func(b []byte) float32
+	switch {
+	case format == wavFormatPCM && bits == 16:
+		sample = func(b []byte) float32 {
+			return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		}
+	case format == wavFormatPCM && bits == 24:
+		sample = func(b []byte) float32 {
+			return float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		}
+	case format == wavFormatPCM && bits == 32:
+		sample = func(b []byte) float32 {
+			return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}
+	case format == wavFormatFloat && bits == 32:
+		sample = func(b []byte) float32 {
+			return math.Float32frombits(binary.LittleEndian.Uint32(b))
+		}
+	default:
+		return nil, ErrUnsupportedWAV
+	}
+
+	width := bits / 8
+	frameSize := width * channels
+	clip := &Clip{
+		SampleRate: rate,
+		Samples:    make([]float32, len(data)/frameSize),
+	}
+
+	for i := range clip.Samples {
+		frame := data[i*frameSize:]
+		sum := float32(0)
+		for c := range channels {
+			sum += sample(frame[c*width:])
+		}
+		clip.Samples[i] = sum / float32(channels)
+	}
+
+	return clip, nil
+}
+
+func LoadWAV(path string) (*Clip, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadWAV(file)
+}
@@ -0,0 +1,188 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/locale"
+	"github.com/kvarenzn/ssm/log"
+	"github.com/kvarenzn/ssm/stage"
+	"github.com/kvarenzn/ssm/term"
+)
+
+var errCalibrationAborted = errors.New("calibration aborted")
+
+// tap taps the landscape screen at the pixel returned by at for the size of the screen.
+// The backends only accept stage coordinates, so a one pixel wide stage is placed right there.
+func tap(controller controllers.Controller, at func(width, height float64) (float64, float64)) error {
+	events, err := controller.Preprocess(common.RawVirtualEvents{
+		{
+			Timestamp: 0,
+			Events: []*common.VirtualTouchEvent{
+				{PointerID: 0, Action: common.TouchDown},
+			},
+		},
+		{
+			Timestamp: 50,
+			Events: []*common.VirtualTouchEvent{
+				{PointerID: 0, Action: common.TouchUp},
+			},
+		},
+	}, func(width, height float64) *stage.Layout {
+		x, y := at(width, height)
+		return &stage.Layout{
+			Left:    x,
+			Right:   x + 1,
+			JudgeY:  y,
+			VanishY: math.Inf(-1),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := controller.Send(events[0].Data); err != nil {
+		return err
+	}
+	time.Sleep(time.Duration(events[1].Timestamp-events[0].Timestamp) * time.Millisecond)
+	return controller.Send(events[1].Data)
+}
+
+// tapAt taps the landscape screen at (x, y) in pixels of the whole screen,
+// the controller may map the touches through a smaller screen (e.g. the video with `-m`)
+func tapAt(controller controllers.Controller, dc *config.DeviceConfig, x, y float64) error {
+	return tap(controller, func(width, height float64) (float64, float64) {
+		return dc.Scale(x, y, width, height)
+	})
+}
+
+func calibrationLanes(spec *stage.LayoutSpec) []int {
+	lanes := []int{0}
+	if middle := (spec.Lanes - 1) / 2; middle > 0 {
+		lanes = append(lanes, middle)
+	}
+	if last := spec.Lanes - 1; last > lanes[len(lanes)-1] {
+		lanes = append(lanes, last)
+	}
+	return lanes
+}
+
+// fitCalibration fits x = left + (right - left) * lane with least squares, judge line y is the mean of ys
+func fitCalibration(lanes, xs, ys []float64) *config.StageCalibration {
+	n := float64(len(lanes))
+	var sl, sx, sll, slx, sy float64
+	for i := range lanes {
+		sl += lanes[i]
+		sx += xs[i]
+		sll += lanes[i] * lanes[i]
+		slx += lanes[i] * xs[i]
+		sy += ys[i]
+	}
+
+	width := 0.0
+	if d := n*sll - sl*sl; d != 0 {
+		width = (n*slx - sl*sx) / d
+	}
+	left := (sx - width*sl) / n
+
+	return &config.StageCalibration{
+		Left:   left,
+		Right:  left + width,
+		JudgeY: sy / n,
+	}
+}
+
+func calibrate(conf *config.Config, dc *config.DeviceConfig, controller controllers.Controller) error {
+	if err := term.PrepareTerminal(); err != nil {
+		return err
+	}
+	defer term.RestoreTerminal()
+
+	spec := getLayoutSpec()
+	layout := getLayoutCalculator(dc)(float64(dc.Height), float64(dc.Width))
+
+	lanes := calibrationLanes(spec)
+	var laneXs, xs, ys []float64
+	for i, lane := range lanes {
+		laneX := spec.LaneX(lane)
+		x, y := layout.Project(laneX, 0)
+
+		for confirmed := false; !confirmed; {
+			term.ClearScreen()
+			term.ResetCursor()
+			fmt.Println(locale.P.Sprintf("Calibrating stage layout `%s` (%d/%d)", getLayoutName(), i+1, len(lanes)))
+			fmt.Println()
+			fmt.Println(locale.P.Sprintf("calibration hint: lane %d", lane+1))
+			fmt.Println()
+			fmt.Println(locale.P.Sprintf("Position: (%.0f, %.0f)", x, y))
+			fmt.Println()
+			fmt.Println(locale.P.Sprintf("calibration keys"))
+
+			if err := tapAt(controller, dc, x, y); err != nil {
+				return err
+			}
+
+			key, err := term.ReadKey(os.Stdin, 10*time.Millisecond)
+			if err != nil {
+				return err
+			}
+
+			switch key {
+			case term.KEY_LEFT:
+				x--
+			case term.KEY_SHIFT_LEFT:
+				x -= 10
+			case term.KEY_CTRL_LEFT:
+				x -= 50
+			case term.KEY_RIGHT:
+				x++
+			case term.KEY_SHIFT_RIGHT:
+				x += 10
+			case term.KEY_CTRL_RIGHT:
+				x += 50
+			case term.KEY_UP:
+				y--
+			case term.KEY_SHIFT_UP:
+				y -= 10
+			case term.KEY_CTRL_UP:
+				y -= 50
+			case term.KEY_DOWN:
+				y++
+			case term.KEY_SHIFT_DOWN:
+				y += 10
+			case term.KEY_CTRL_DOWN:
+				y += 50
+			case term.KEY_ENTER, term.KEY_SPACE:
+				confirmed = true
+			case term.KEY_ESC:
+				return errCalibrationAborted
+			}
+		}
+
+		laneXs = append(laneXs, laneX)
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+
+	calibration := fitCalibration(laneXs, xs, ys)
+	if dc.Calibrations == nil {
+		dc.Calibrations = map[string]*config.StageCalibration{}
+	}
+	dc.Calibrations[getLayoutName()] = calibration
+	if err := conf.Save(); err != nil {
+		return err
+	}
+
+	term.RestoreTerminal()
+	log.Infof("Calibration saved: left %.1f, right %.1f, judge line %.1f", calibration.Left, calibration.Right, calibration.JudgeY)
+	return nil
+}
@@ -3,6 +3,13 @@
 
 package common
 
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidEventStream = errors.New("invalid touch event stream")
+
 type TouchAction uint8
 
 const (
@@ -16,6 +23,29 @@ const (
 	TouchHoverMove
 )
 
+func (a TouchAction) String() string {
+	switch a {
+	case TouchDown:
+		return "down"
+	case TouchUp:
+		return "up"
+	case TouchMove:
+		return "move"
+	case TouchCancel:
+		return "cancel"
+	case TouchOutside:
+		return "outside"
+	case TouchPointerDown:
+		return "pointer-down"
+	case TouchPointerUp:
+		return "pointer-up"
+	case TouchHoverMove:
+		return "hover-move"
+	default:
+		return fmt.Sprintf("TouchAction(%d)", uint8(a))
+	}
+}
+
 type VirtualTouchEvent struct {
 	PointerID int         `json:"pointerId"`
 	Action    TouchAction `json:"action"`
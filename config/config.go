@@ -5,19 +5,66 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+
+	"github.com/kvarenzn/ssm/log"
 )
 
+// StageCalibration overrides the judge line position of a stage layout,
+// in pixels of the whole landscape screen (`Height` x `Width` of the device)
+type StageCalibration struct {
+	Left   float64 `json:"left"`
+	Right  float64 `json:"right"`
+	JudgeY float64 `json:"judgeY"`
+}
+
+// HIDOptions selects the optional fields of the HID touchscreen descriptor
+type HIDOptions struct {
+	Fingers      int  `json:"fingers,omitempty"`
+	Pressure     bool `json:"pressure,omitempty"`
+	ContactSize  int  `json:"contactSize,omitempty"`
+	ContactCount bool `json:"contactCount,omitempty"`
+	ScanTime     bool `json:"scanTime,omitempty"`
+}
+
 type DeviceConfig struct {
 	Serial string `json:"-"`
 	Width  int    `json:"width"`
 	Height int    `json:"height"`
+
+	// keyed by stage layout name
+	Calibrations map[string]*StageCalibration `json:"calibrations,omitempty"`
+
+	// used by the `hid` backend, nil means the classic 10 finger descriptor
+	HID *HIDOptions `json:"hid,omitempty"`
+}
+
+// Scale maps a point in pixels of the whole landscape screen to a landscape screen of width x height,
+// e.g. the video frame downscaled with `-m`
+func (dc *DeviceConfig) Scale(x, y, width, height float64) (float64, float64) {
+	return x * width / float64(dc.Height), y * height / float64(dc.Width)
+}
+
+// ScrcpyOptions controls how `scrcpy-server` is launched by the `adb` backend, zero values mean the defaults
+type ScrcpyOptions struct {
+	ServerPath  string `json:"serverPath,omitempty"`
+	Version     string `json:"version,omitempty"`
+	NoVideo     bool   `json:"noVideo,omitempty"`
+	MaxSize     int    `json:"maxSize,omitempty"`
+	BitRate     int    `json:"bitRate,omitempty"`
+	Codec       string `json:"codec,omitempty"`       // h264, h265 or av1
+	AudioSource string `json:"audioSource,omitempty"` // empty to disable audio
+	AudioCodec  string `json:"audioCodec,omitempty"`  // opus, aac, flac or raw
+	DisplayID   int    `json:"displayId,omitempty"`
+	LogLevel    string `json:"logLevel,omitempty"`
 }
 
 type Config struct {
 	Path    string                   `json:"-"`
 	Devices map[string]*DeviceConfig `json:"devices"`
+	Scrcpy  *ScrcpyOptions           `json:"scrcpy,omitempty"`
 }
 
 func (c *Config) askFor(serial string) *DeviceConfig {
@@ -37,20 +84,55 @@ func (c *Config) askFor(serial string) *DeviceConfig {
 	return dc
 }
 
+// SizeProbe queries the screen size of a device, in any orientation
+type SizeProbe func() (width, height int, err error)
+
 func (c *Config) Get(serial string) *DeviceConfig {
+	return c.Lookup(serial, nil)
+}
+
+// Lookup returns the config of the device. The screen size of an unknown device is queried with probe,
+// the user is asked only if probe is nil or fails. A known device is checked against probe as well.
+func (c *Config) Lookup(serial string, probe SizeProbe) *DeviceConfig {
 	if c.Devices == nil {
 		c.Devices = map[string]*DeviceConfig{}
 	}
 
+	var width, height int
+	var err error = errors.New("no size probe")
+	if probe != nil {
+		width, height, err = probe()
+		width, height = min(width, height), max(width, height)
+	}
+
+	if err != nil {
+		log.Debugln("Failed to query screen size:", err)
+	} else {
+		log.Debugf("Screen size of device [%s]: %dx%d", serial, width, height)
+	}
+
 	if dc, ok := c.Devices[serial]; ok {
 		dc.Serial = serial
+		if err == nil && (dc.Width != width || dc.Height != height) {
+			log.Warnf("Screen size of device [%s] is %dx%d, but %dx%d is saved in config, touches may be misplaced", serial, width, height, dc.Width, dc.Height)
+		}
 		return dc
+	}
+
+	var dc *DeviceConfig
+	if err == nil {
+		dc = &DeviceConfig{
+			Serial: serial,
+			Width:  width,
+			Height: height,
+		}
 	} else {
 		dc = c.askFor(serial)
-		c.Devices[serial] = dc
-		c.Save()
-		return dc
 	}
+
+	c.Devices[serial] = dc
+	c.Save()
+	return dc
 }
 
 func Load(path string) (*Config, error) {
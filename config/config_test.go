@@ -0,0 +1,27 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/kvarenzn/ssm/config"
+)
+
+func TestScale(t *testing.T) {
+	dc := &config.DeviceConfig{Width: 1080, Height: 2400}
+
+	for _, tc := range []struct {
+		name          string
+		width, height float64
+		x, y          float64
+	}{
+		{"whole screen", 2400, 1080, 600, 900},
+		{"downscaled", 1200, 540, 300, 450},
+		{"other aspect", 1920, 1080, 480, 900},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if x, y := dc.Scale(600, 900, tc.width, tc.height); x != tc.x || y != tc.y {
+				t.Errorf("Got (%v, %v), want (%v, %v)", x, y, tc.x, tc.y)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/stage"
+	"github.com/kvarenzn/ssm/utils"
+)
+
+type Options struct {
+	Device    *config.DeviceConfig
+	TurnRight bool
+
+	// used by the `adb` backend
+	Scrcpy    *config.ScrcpyOptions
+	UHID      bool   // send touches through a virtual UHID touchscreen
+	VideoPath string // record the screen to this file (.mkv, .mp4, ...) if not empty
+
+	// used by the `record-hid` and `record-adb` backends
+	RecordPath string
+}
+
+type Controller interface {
+	// Size returns the width (short side) and height (long side) of the device screen
+	Size() (int, int)
+	// Preprocess fails with common.ErrInvalidEventStream if the events are inconsistent
+	Preprocess(rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error)
+	// Send fails with ErrDeviceDisconnected or ErrTimeout (possibly wrapped) on transport errors
+	Send(data []byte) error
+	Close() error
+}
+
+// Reconnector is implemented by controllers that can wait for their device to come back after ErrDeviceDisconnected.
+// Payloads of such controllers carry the complete touch state, so playback may resume from the latest due payload.
+type Reconnector interface {
+	Reconnect(ctx context.Context) error
+}
+
+// Releaser is implemented by controllers that can lift every finger at once, e.g. when the play is paused or stopped.
+// Touches sent afterwards put the fingers that are still needed down again.
+type Releaser interface {
+	ReleaseAll() error
+}
+
+type Backend interface {
+	// Devices lists serials of the devices that are ready to be opened
+	Devices() ([]string, error)
+	Open(serial string, opts *Options) (Controller, error)
+}
+
+var backends = map[string]Backend{}
+
+func Register(name string, backend Backend) {
+	backends[name] = backend
+}
+
+func Get(name string) (Backend, bool) {
+	b, ok := backends[name]
+	return b, ok
+}
+
+func Names() []string {
+	return utils.SortedKeysOf(backends)
+}
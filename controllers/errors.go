@@ -0,0 +1,50 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/google/gousb"
+)
+
+var (
+	ErrDeviceDisconnected = errors.New("device disconnected")
+	ErrTimeout            = errors.New("device timed out")
+)
+
+func wrapUSBError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, gousb.ErrorNoDevice), errors.Is(err, gousb.ErrorIO), errors.Is(err, gousb.ErrorPipe):
+		return fmt.Errorf("%w: %w", ErrDeviceDisconnected, err)
+	case errors.Is(err, gousb.ErrorTimeout):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	default:
+		return err
+	}
+}
+
+func wrapSocketError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed), errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNRESET):
+		return fmt.Errorf("%w: %w", ErrDeviceDisconnected, err)
+	default:
+		return err
+	}
+}
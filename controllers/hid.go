@@ -4,8 +4,11 @@
 package controllers
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/gousb"
 
@@ -15,52 +18,6 @@ import (
 	"github.com/kvarenzn/ssm/stage"
 )
 
-var _REPORT_DESC_HEAD = []byte{
-	0x05, 0x0d, // Usage Page (Digitalizers)
-	0x09, 0x04, // Usage (Touch Screen)
-	0xa1, 0x01, // Collection (Application)
-	0x15, 0x00, //		Logical Mininum (0)
-}
-
-var _REPORT_DESC_BODY_PART1 = []byte{
-	0x09, 0x22, //		Usage (Fingers)
-	0xa1, 0x02, //		Collection (Logical)
-	0x09, 0x51, //			Usage (Contact Identifier)
-	0x75, 0x04, //			Report Size (4)
-	0x95, 0x01, //			Report Count (1)
-	0x25, 0x09, //			Logical Maximum (9)
-	0x81, 0x02, //			Input (Data, Variable, Absolute)
-	0x09, 0x42, //			Usage (Tip Switch)
-	0x25, 0x01, //			Logical Maximum (1)
-	0x75, 0x01, //			Report Size (1)
-	0x81, 0x02, //			Input (Data, Variable, Absolute)
-	0x09, 0x32, //			Usage (In Range)
-	0x25, 0x01, //			Logical Maximum (1)
-	0x81, 0x02, //			Input (Data, Variable, Absolute)
-	0x75, 0x02, //			Report Size (2)
-	0x81, 0x01, //			Input (Constant)
-	0x05, 0x01, //			Usage Page (Generic Desktop Page)
-	0x09, 0x30, //			Usage (X)
-	0x26, //				Logical Maximum (Currently Unknown)
-}
-
-var _REPORT_DESC_BODY_PART2 = []byte{
-	0x75, 0x10, //			Report Size (16)
-	0x81, 0x02, //			Input (Data, Variable, Absolute)
-	0x09, 0x31, //			Usage (Y)
-	0x26, //				Logical Maximum (Currently Unknown)
-}
-
-var _REPORT_DESC_BODY_PART3 = []byte{
-	0x81, 0x02, //			Input (Data, Variable, Absolute)
-	0x05, 0x0d, //			Usage Page (Digitalizers)
-	0xc0, //			End Collection
-}
-
-var _REPORT_DESC_TAIL = []byte{
-	0xc0, //		End Collection
-}
-
 const ACCESSORY_ID uint16 = 114514 & 0xffff
 
 func fingerEvent(id int, onScreen bool, x, y int) []byte {
@@ -82,26 +39,22 @@ type PointerStatus struct {
 	OnScreen bool
 }
 
-func genHIDEventData(pointers []PointerStatus) []byte {
-	result := bytes.NewBuffer([]byte{})
-	for i, s := range pointers {
-		result.Write(fingerEvent(i, s.OnScreen, s.X, s.Y))
-	}
-	return result.Bytes()
+func genHIDEventData(desc *HIDDescriptor, pointers []PointerStatus, timestamp int64) []byte {
+	return desc.Report(pointers, timestamp)
 }
 
 type HIDController struct {
-	serial            string
 	dc                *config.DeviceConfig
+	turnRight         bool
 	device            *gousb.Device
+	descriptor        *HIDDescriptor
 	reportDescription []byte
 	usbContext        *gousb.Context
+	since             time.Time // scan times are counted from here, so that they go forward however the reports are sent
 }
 
-func NewHIDController(dc *config.DeviceConfig) *HIDController {
-	usbContext := gousb.NewContext()
-	// defer usbContext.Close()
-
+// openHIDDevice opens the USB device with the given serial, returns nil if it is not connected
+func openHIDDevice(usbContext *gousb.Context, serial string) *gousb.Device {
 	devs, _ := usbContext.OpenDevices(func(desc *gousb.DeviceDesc) bool {
 		if desc.Class != gousb.ClassPerInterface || desc.SubClass != gousb.ClassPerInterface {
 			return false
@@ -113,7 +66,7 @@ func NewHIDController(dc *config.DeviceConfig) *HIDController {
 
 	for _, dev := range devs {
 		s, err := dev.SerialNumber()
-		if err != nil || s != dc.Serial {
+		if err != nil || s != serial {
 			dev.Close()
 			continue
 		}
@@ -125,33 +78,26 @@ func NewHIDController(dc *config.DeviceConfig) *HIDController {
 		}
 	}
 
-	uint16Buffer := make([]byte, 2)
-
-	reportDescBody := bytes.NewBuffer(nil)
-	reportDescBody.Write(_REPORT_DESC_BODY_PART1)
-	binary.LittleEndian.PutUint16(uint16Buffer, uint16(dc.Width))
-	reportDescBody.Write(uint16Buffer)
-	reportDescBody.Write(_REPORT_DESC_BODY_PART2)
-	binary.LittleEndian.PutUint16(uint16Buffer, uint16(dc.Height))
-	reportDescBody.Write(uint16Buffer)
-	reportDescBody.Write(_REPORT_DESC_BODY_PART3)
-
-	reportDescription := bytes.NewBuffer(nil)
-	reportDescription.Write(_REPORT_DESC_HEAD)
-	for range 10 {
-		reportDescription.Write(reportDescBody.Bytes())
-	}
-	reportDescription.Write(_REPORT_DESC_TAIL)
+	return device
+}
+
+func NewHIDController(dc *config.DeviceConfig) *HIDController {
+	usbContext := gousb.NewContext()
+	device := openHIDDevice(usbContext, dc.Serial)
+
+	descriptor := NewHIDDescriptor(dc)
 
 	return &HIDController{
 		dc:                dc,
 		device:            device,
-		reportDescription: reportDescription.Bytes(),
+		descriptor:        descriptor,
+		reportDescription: descriptor.Bytes(),
 		usbContext:        usbContext,
+		since:             time.Now(),
 	}
 }
 
-func (c *HIDController) registerHID() {
+func (c *HIDController) registerHID() error {
 	_, err := c.device.Control(
 		64, // ENDPOINT_OUT | REQUEST_TYPE_VENDOR
 		54, // ACCESSORY_REGISTER_HID
@@ -159,12 +105,10 @@ func (c *HIDController) registerHID() {
 		uint16(len(c.reportDescription)),
 		nil,
 	)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return wrapUSBError(err)
 }
 
-func (c *HIDController) unregisterHID() {
+func (c *HIDController) unregisterHID() error {
 	_, err := c.device.Control(
 		64, // ENDPOINT_OUT | REQUEST_TYPE_VENDOR
 		55, // ACCESSORY_UNREGISTER_ID
@@ -172,12 +116,10 @@ func (c *HIDController) unregisterHID() {
 		0,
 		nil,
 	)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return wrapUSBError(err)
 }
 
-func (c *HIDController) setHIDReportDescription() {
+func (c *HIDController) setHIDReportDescription() error {
 	_, err := c.device.Control(
 		64, // ENDPOINT_OUT | REQUEST_TYPE_VENDOR
 		56, // ACCESSORY_SET_HID_REPORT_DESC
@@ -185,12 +127,10 @@ func (c *HIDController) setHIDReportDescription() {
 		0,
 		c.reportDescription,
 	)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return wrapUSBError(err)
 }
 
-func (c *HIDController) sendHIDEvent(event []byte) {
+func (c *HIDController) sendHIDEvent(event []byte) error {
 	_, err := c.device.Control(
 		64, // ENDPOINT_OUT | REQUEST_TYPE_VENDOR
 		57, // ACCESSORY_SEND_HID_EVENT
@@ -198,67 +138,133 @@ func (c *HIDController) sendHIDEvent(event []byte) {
 		0,
 		event,
 	)
-	if err != nil {
-		log.Fatal(err)
+	return wrapUSBError(err)
+}
+
+func (c *HIDController) Open() error {
+	if err := c.registerHID(); err != nil {
+		return err
 	}
+
+	return c.setHIDReportDescription()
+}
+
+func (c *HIDController) Send(data []byte) error {
+	return c.sendHIDEvent(c.descriptor.StampScanTime(data, time.Since(c.since)))
+}
+
+// release returns the report with every finger lifted
+func (c *HIDController) release() []byte {
+	return genHIDEventData(c.descriptor, nil, 0)
 }
 
-func (c *HIDController) Open() {
-	c.registerHID()
-	c.setHIDReportDescription()
+// ReleaseAll lifts every finger. Reports carry the complete touch state, the next one puts the fingers down again.
+func (c *HIDController) ReleaseAll() error {
+	return c.Send(c.release())
 }
 
-func (c *HIDController) Send(data []byte) {
-	c.sendHIDEvent(data)
+const reconnectPollInterval = 500 * time.Millisecond
+
+// Reconnect waits for the device with the same serial to come back, then registers the HID accessory again.
+func (c *HIDController) Reconnect(ctx context.Context) error {
+	if c.device != nil {
+		c.device.Close()
+		c.device = nil
+	}
+
+	ticker := time.NewTicker(reconnectPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if device := openHIDDevice(c.usbContext, c.dc.Serial); device != nil {
+			c.device = device
+			err := c.Open()
+			if err == nil {
+				log.Debugln("HID device reconnected:", c.dc.Serial)
+				return nil
+			}
+
+			if !errors.Is(err, ErrDeviceDisconnected) {
+				return err
+			}
+
+			log.Debugln("Failed to register HID accessory, retrying:", err)
+			c.device.Close()
+			c.device = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
 
 func (c *HIDController) Close() error {
-	c.unregisterHID()
-	if err := c.device.Close(); err != nil {
-		return err
+	if c.device == nil {
+		return c.usbContext.Close()
 	}
-	return c.usbContext.Close()
+
+	// so that no finger stays on screen after the accessory is gone
+	errs := []error{c.ReleaseAll(), c.unregisterHID()}
+	errs = append(errs, c.device.Close())
+	errs = append(errs, c.usbContext.Close())
+	return errors.Join(errs...)
+}
+
+func (c *HIDController) Size() (int, int) {
+	return c.dc.Width, c.dc.Height
+}
+
+func (c *HIDController) Preprocess(rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error) {
+	return genHIDReports(c.descriptor, c.turnRight, rawEvents, calc)
 }
 
-func (c *HIDController) Preprocess(rawEvents common.RawVirtualEvents, turnRight bool, calc stage.JudgeLinePositionCalculator) []common.ViscousEventItem {
-	width, height := float64(c.dc.Height), float64(c.dc.Width)
-	x1, x2, yy := calc(width, height)
-	dx := x2 - x1
+// genHIDReports maps the events to the portrait screen of the descriptor and encodes them as reports.
+// Every report carries the complete touch state.
+func genHIDReports(desc *HIDDescriptor, turnRight bool, rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error) {
+	width, height := float64(desc.Height), float64(desc.Width)
+	layout := calc(width, height)
 	mapper := func(x, y float64) (int, int) {
-		return crinterp(height-yy, height-yy+dx, y, 0, height),
-			crinterp(x1, x2, x, 0, width)
+		px, py := layout.Project(x, y)
+		return clamp(roundint(height-py), 0, desc.Width), clamp(roundint(px), 0, desc.Height)
 	}
 	if turnRight {
 		mapper = func(x, y float64) (int, int) {
-			ix, iy := crinterp(height-yy, height-yy+dx, y, 0, height),
-				crinterp(x1, x2, x, 0, width)
-			return c.dc.Width - ix, c.dc.Height - iy
+			px, py := layout.Project(x, y)
+			ix, iy := clamp(roundint(height-py), 0, desc.Width), clamp(roundint(px), 0, desc.Height)
+			return desc.Width - ix, desc.Height - iy
 		}
 	}
 
 	result := []common.ViscousEventItem{}
-	currentFingers := make([]PointerStatus, 10)
+	currentFingers := make([]PointerStatus, desc.Fingers)
 	for _, events := range rawEvents {
 		for _, event := range events.Events {
+			if event.PointerID < 0 || event.PointerID >= len(currentFingers) {
+				return nil, fmt.Errorf("%w: pointer `%d` exceeds the %d fingers of the HID descriptor", common.ErrInvalidEventStream, event.PointerID, len(currentFingers))
+			}
+
 			x, y := mapper(event.X, event.Y)
 			status := currentFingers[event.PointerID]
 			switch event.Action {
 			case common.TouchDown:
 				if status.OnScreen {
-					log.Fatalf("pointer `%d` is already on screen", event.PointerID)
+					return nil, fmt.Errorf("%w: pointer `%d` is already on screen", common.ErrInvalidEventStream, event.PointerID)
 				}
 				status.OnScreen = true
 			case common.TouchMove:
 				if !status.OnScreen {
-					log.Fatalf("pointer `%d` is not on screen", event.PointerID)
+					return nil, fmt.Errorf("%w: pointer `%d` is not on screen", common.ErrInvalidEventStream, event.PointerID)
 				}
 			case common.TouchUp:
 				if !status.OnScreen {
-					log.Fatalf("pointer `%d` is not on screen", event.PointerID)
+					return nil, fmt.Errorf("%w: pointer `%d` is not on screen", common.ErrInvalidEventStream, event.PointerID)
 				}
 				status.OnScreen = false
 			default:
-				log.Fatalf("unknown touch action: %d\n", event.Action)
+				return nil, fmt.Errorf("%w: unknown touch action: %d", common.ErrInvalidEventStream, event.Action)
 			}
 			status.X = x
 			status.Y = y
@@ -266,19 +272,19 @@ func (c *HIDController) Preprocess(rawEvents common.RawVirtualEvents, turnRight
 		}
 		result = append(result, common.ViscousEventItem{
 			Timestamp: events.Timestamp,
-			Data:      genHIDEventData(currentFingers),
+			Data:      genHIDEventData(desc, currentFingers, events.Timestamp),
 		})
 	}
-	return result
+	return result, nil
 }
 
-func FindHIDDevices() []string {
+func FindHIDDevices() ([]string, error) {
 	result := []string{}
 
 	ctx := gousb.NewContext()
 	defer ctx.Close()
 
-	devs, _ := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+	devs, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
 		if desc.Class != gousb.ClassPerInterface || desc.SubClass != gousb.ClassPerInterface {
 			return false
 		}
@@ -292,15 +298,42 @@ func FindHIDDevices() []string {
 			result = append(result, serial)
 		}
 
-		err = dev.Close()
-		if err != nil {
-			log.Fatal(err)
+		if err := dev.Close(); err != nil {
+			log.Debugln("Failed to close USB device:", err)
 		}
 	}
 
-	return result
+	// some devices may fail to open (e.g. no permission), ignore them if others are found
+	if len(result) == 0 && err != nil {
+		return nil, wrapUSBError(err)
+	}
+
+	return result, nil
+}
+
+type hidBackend struct{}
+
+func (hidBackend) Devices() ([]string, error) {
+	return FindHIDDevices()
+}
+
+func (hidBackend) Open(serial string, opts *Options) (Controller, error) {
+	c := NewHIDController(opts.Device)
+	if c.device == nil {
+		c.usbContext.Close()
+		return nil, fmt.Errorf("no device has serial `%s`", serial)
+	}
+
+	c.turnRight = opts.TurnRight
+	if err := c.Open(); err != nil {
+		c.device.Close()
+		c.usbContext.Close()
+		return nil, err
+	}
+
+	return c, nil
 }
 
-type Controller interface {
-	Send(data []byte)
+func init() {
+	Register("hid", hidBackend{})
 }
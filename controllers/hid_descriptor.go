@@ -0,0 +1,244 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"time"
+
+	"github.com/kvarenzn/ssm/config"
+)
+
+const (
+	defaultHIDFingers = 10
+	maxHIDFingers     = 16 // contact identifier is 4 bits wide
+)
+
+// HIDDescriptor describes the touchscreen registered through ACCESSORY_REGISTER_HID.
+// Reports are laid out in the order the fields are declared in the descriptor, little endian, LSB first.
+type HIDDescriptor struct {
+	Fingers int // contacts in every report
+	Width   int // logical maximum of X
+	Height  int // logical maximum of Y
+
+	Pressure     bool // Tip Pressure (8 bits) of every contact, full while on screen
+	ContactSize  int  // if positive, Width and Height (16 bits each) of every contact while on screen
+	ContactCount bool // Contact Count (8 bits) after the contacts
+	ScanTime     bool // Scan Time (16 bits, 100µs) after the contacts
+}
+
+func NewHIDDescriptor(dc *config.DeviceConfig) *HIDDescriptor {
+	d := &HIDDescriptor{
+		Fingers: defaultHIDFingers,
+		Width:   dc.Width,
+		Height:  dc.Height,
+	}
+
+	if opts := dc.HID; opts != nil {
+		if opts.Fingers > 0 {
+			d.Fingers = min(opts.Fingers, maxHIDFingers)
+		}
+		d.Pressure = opts.Pressure
+		d.ContactSize = opts.ContactSize
+		d.ContactCount = opts.ContactCount
+		d.ScanTime = opts.ScanTime
+	}
+
+	return d
+}
+
+func le16(v int) []byte {
+	return binary.LittleEndian.AppendUint16(nil, uint16(v))
+}
+
+// Bytes builds the report descriptor
+func (d *HIDDescriptor) Bytes() []byte {
+	b := bytes.NewBuffer(nil)
+	b.Write([]byte{
+		0x05, 0x0d, // Usage Page (Digitalizers)
+		0x09, 0x04, // Usage (Touch Screen)
+		0xa1, 0x01, // Collection (Application)
+		0x15, 0x00, //		Logical Mininum (0)
+	})
+
+	for range d.Fingers {
+		b.Write([]byte{
+			0x09, 0x22, //		Usage (Fingers)
+			0xa1, 0x02, //		Collection (Logical)
+			0x09, 0x51, //			Usage (Contact Identifier)
+			0x75, 0x04, //			Report Size (4)
+			0x95, 0x01, //			Report Count (1)
+			0x25, byte(d.Fingers - 1), //			Logical Maximum (Fingers - 1)
+			0x81, 0x02, //			Input (Data, Variable, Absolute)
+			0x09, 0x42, //			Usage (Tip Switch)
+			0x25, 0x01, //			Logical Maximum (1)
+			0x75, 0x01, //			Report Size (1)
+			0x81, 0x02, //			Input (Data, Variable, Absolute)
+			0x09, 0x32, //			Usage (In Range)
+			0x25, 0x01, //			Logical Maximum (1)
+			0x81, 0x02, //			Input (Data, Variable, Absolute)
+			0x75, 0x02, //			Report Size (2)
+			0x81, 0x01, //			Input (Constant)
+			0x05, 0x01, //			Usage Page (Generic Desktop Page)
+			0x09, 0x30, //			Usage (X)
+			0x26, //				Logical Maximum (Width)
+		})
+		b.Write(le16(d.Width))
+		b.Write([]byte{
+			0x75, 0x10, //			Report Size (16)
+			0x81, 0x02, //			Input (Data, Variable, Absolute)
+			0x09, 0x31, //			Usage (Y)
+			0x26, //				Logical Maximum (Height)
+		})
+		b.Write(le16(d.Height))
+		b.Write([]byte{
+			0x81, 0x02, //			Input (Data, Variable, Absolute)
+			0x05, 0x0d, //			Usage Page (Digitalizers)
+		})
+
+		if d.Pressure {
+			b.Write([]byte{
+				0x09, 0x30, //			Usage (Tip Pressure)
+				0x75, 0x08, //			Report Size (8)
+				0x26, 0xff, 0x00, //	Logical Maximum (255)
+				0x81, 0x02, //			Input (Data, Variable, Absolute)
+			})
+		}
+
+		if d.ContactSize > 0 {
+			b.Write([]byte{
+				0x09, 0x48, //			Usage (Width)
+				0x75, 0x10, //			Report Size (16)
+				0x26, //				Logical Maximum (Width)
+			})
+			b.Write(le16(d.Width))
+			b.Write([]byte{
+				0x81, 0x02, //			Input (Data, Variable, Absolute)
+				0x09, 0x49, //			Usage (Height)
+				0x26, //				Logical Maximum (Height)
+			})
+			b.Write(le16(d.Height))
+			b.Write([]byte{
+				0x81, 0x02, //			Input (Data, Variable, Absolute)
+			})
+		}
+
+		b.Write([]byte{
+			0xc0, //			End Collection
+		})
+	}
+
+	if d.ContactCount {
+		b.Write([]byte{
+			0x09, 0x54, //		Usage (Contact Count)
+			0x75, 0x08, //		Report Size (8)
+			0x25, byte(d.Fingers), //		Logical Maximum (Fingers)
+			0x81, 0x02, //		Input (Data, Variable, Absolute)
+		})
+	}
+
+	if d.ScanTime {
+		b.Write([]byte{
+			0x55, 0x0c, //		Unit Exponent (-4)
+			0x66, 0x01, 0x10, //	Unit (Seconds)
+			0x47, 0xff, 0xff, 0x00, 0x00, //	Physical Maximum (65535)
+			0x27, 0xff, 0xff, 0x00, 0x00, //	Logical Maximum (65535)
+			0x75, 0x10, //		Report Size (16)
+			0x09, 0x56, //		Usage (Scan Time)
+			0x81, 0x02, //		Input (Data, Variable, Absolute)
+		})
+	}
+
+	b.Write([]byte{
+		0xc0, //		End Collection
+	})
+
+	return b.Bytes()
+}
+
+// fingerSize is the size of a single contact in a report, in bytes
+func (d *HIDDescriptor) fingerSize() int {
+	size := 5
+	if d.Pressure {
+		size++
+	}
+	if d.ContactSize > 0 {
+		size += 4
+	}
+	return size
+}
+
+// ReportSize is the size of a report, in bytes
+func (d *HIDDescriptor) ReportSize() int {
+	size := d.Fingers * d.fingerSize()
+	if d.ContactCount {
+		size++
+	}
+	if d.ScanTime {
+		size += 2
+	}
+	return size
+}
+
+// Report encodes the state of the first d.Fingers pointers, timestamp is in milliseconds.
+// The scan time has to go forward in the order the reports are sent, see StampScanTime.
+func (d *HIDDescriptor) Report(pointers []PointerStatus, timestamp int64) []byte {
+	result := bytes.NewBuffer(make([]byte, 0, d.ReportSize()))
+	count := 0
+	for i := range d.Fingers {
+		var s PointerStatus
+		if i < len(pointers) {
+			s = pointers[i]
+		}
+
+		result.Write(fingerEvent(i, s.OnScreen, s.X, s.Y))
+
+		if s.OnScreen {
+			count++
+		}
+
+		if d.Pressure {
+			if s.OnScreen {
+				result.WriteByte(0xff)
+			} else {
+				result.WriteByte(0)
+			}
+		}
+
+		if d.ContactSize > 0 {
+			size := 0
+			if s.OnScreen {
+				size = d.ContactSize
+			}
+			result.Write(le16(size))
+			result.Write(le16(size))
+		}
+	}
+
+	if d.ContactCount {
+		result.WriteByte(byte(count))
+	}
+
+	if d.ScanTime {
+		// wraps around, as the spec allows
+		result.Write(le16(int(timestamp * 10)))
+	}
+
+	return result.Bytes()
+}
+
+// StampScanTime returns a copy of report with the scan time set to elapsed, the time it is sent
+// since the touchscreen was registered. Reports without scan time are returned as is.
+func (d *HIDDescriptor) StampScanTime(report []byte, elapsed time.Duration) []byte {
+	if !d.ScanTime || len(report) != d.ReportSize() {
+		return report
+	}
+
+	result := slices.Clone(report)
+	// wraps around, as the spec allows
+	binary.LittleEndian.PutUint16(result[len(result)-2:], uint16(elapsed/(100*time.Microsecond)))
+	return result
+}
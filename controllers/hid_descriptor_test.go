@@ -0,0 +1,147 @@
+package controllers_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/controllers"
+)
+
+func assertBytes(t *testing.T, val, expected []byte) {
+	t.Helper()
+	if !bytes.Equal(val, expected) {
+		t.Errorf("Expected % x, but got % x", expected, val)
+	}
+}
+
+// the descriptor registered by ssm before it became configurable, for a 1080x2400 device
+func classicDescriptor() []byte {
+	finger := []byte{
+		0x09, 0x22, 0xa1, 0x02,
+		0x09, 0x51, 0x75, 0x04, 0x95, 0x01, 0x25, 0x09, 0x81, 0x02,
+		0x09, 0x42, 0x25, 0x01, 0x75, 0x01, 0x81, 0x02,
+		0x09, 0x32, 0x25, 0x01, 0x81, 0x02,
+		0x75, 0x02, 0x81, 0x01,
+		0x05, 0x01, 0x09, 0x30, 0x26, 0x38, 0x04, 0x75, 0x10, 0x81, 0x02,
+		0x09, 0x31, 0x26, 0x60, 0x09, 0x81, 0x02,
+		0x05, 0x0d, 0xc0,
+	}
+
+	result := []byte{0x05, 0x0d, 0x09, 0x04, 0xa1, 0x01, 0x15, 0x00}
+	for range 10 {
+		result = append(result, finger...)
+	}
+	return append(result, 0xc0)
+}
+
+func TestClassicDescriptor(t *testing.T) {
+	d := controllers.NewHIDDescriptor(&config.DeviceConfig{Width: 1080, Height: 2400})
+	assertBytes(t, d.Bytes(), classicDescriptor())
+	if d.ReportSize() != 50 {
+		t.Errorf("Expected report size 50, but got %d", d.ReportSize())
+	}
+}
+
+func TestFullDescriptor(t *testing.T) {
+	d := controllers.NewHIDDescriptor(&config.DeviceConfig{
+		Width:  1080,
+		Height: 2400,
+		HID: &config.HIDOptions{
+			Fingers:      2,
+			Pressure:     true,
+			ContactSize:  20,
+			ContactCount: true,
+			ScanTime:     true,
+		},
+	})
+
+	finger := []byte{
+		0x09, 0x22, 0xa1, 0x02,
+		0x09, 0x51, 0x75, 0x04, 0x95, 0x01, 0x25, 0x01, 0x81, 0x02,
+		0x09, 0x42, 0x25, 0x01, 0x75, 0x01, 0x81, 0x02,
+		0x09, 0x32, 0x25, 0x01, 0x81, 0x02,
+		0x75, 0x02, 0x81, 0x01,
+		0x05, 0x01, 0x09, 0x30, 0x26, 0x38, 0x04, 0x75, 0x10, 0x81, 0x02,
+		0x09, 0x31, 0x26, 0x60, 0x09, 0x81, 0x02,
+		0x05, 0x0d,
+		0x09, 0x30, 0x75, 0x08, 0x26, 0xff, 0x00, 0x81, 0x02,
+		0x09, 0x48, 0x75, 0x10, 0x26, 0x38, 0x04, 0x81, 0x02,
+		0x09, 0x49, 0x26, 0x60, 0x09, 0x81, 0x02,
+		0xc0,
+	}
+
+	expected := []byte{0x05, 0x0d, 0x09, 0x04, 0xa1, 0x01, 0x15, 0x00}
+	expected = append(expected, finger...)
+	expected = append(expected, finger...)
+	expected = append(expected,
+		0x09, 0x54, 0x75, 0x08, 0x25, 0x02, 0x81, 0x02,
+		0x55, 0x0c, 0x66, 0x01, 0x10, 0x47, 0xff, 0xff, 0x00, 0x00, 0x27, 0xff, 0xff, 0x00, 0x00,
+		0x75, 0x10, 0x09, 0x56, 0x81, 0x02,
+		0xc0,
+	)
+
+	assertBytes(t, d.Bytes(), expected)
+	if d.ReportSize() != 23 {
+		t.Errorf("Expected report size 23, but got %d", d.ReportSize())
+	}
+}
+
+func TestClassicReport(t *testing.T) {
+	d := controllers.NewHIDDescriptor(&config.DeviceConfig{Width: 1080, Height: 2400})
+	pointers := make([]controllers.PointerStatus, 10)
+	pointers[1] = controllers.PointerStatus{X: 0x0123, Y: 0x0456, OnScreen: true}
+
+	expected := make([]byte, 50)
+	for i := range 10 {
+		expected[i*5] = byte(i)
+	}
+	copy(expected[5:], []byte{0x31, 0x23, 0x01, 0x56, 0x04})
+
+	assertBytes(t, d.Report(pointers, 1234), expected)
+}
+
+func TestFullReport(t *testing.T) {
+	d := controllers.NewHIDDescriptor(&config.DeviceConfig{
+		Width:  1080,
+		Height: 2400,
+		HID: &config.HIDOptions{
+			Fingers:      2,
+			Pressure:     true,
+			ContactSize:  20,
+			ContactCount: true,
+			ScanTime:     true,
+		},
+	})
+
+	pointers := []controllers.PointerStatus{
+		{X: 100, Y: 200, OnScreen: true},
+		{X: 300, Y: 400, OnScreen: false},
+	}
+
+	expected := []byte{
+		0x30, 0x64, 0x00, 0xc8, 0x00, 0xff, 0x14, 0x00, 0x14, 0x00,
+		0x01, 0x2c, 0x01, 0x90, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01,
+		0x88, 0x0d, // 6900ms = 69000 * 100µs, wrapped to 16 bits
+	}
+
+	assertBytes(t, d.Report(pointers, 6900), expected)
+}
+
+func TestStampScanTime(t *testing.T) {
+	opts := &config.HIDOptions{Fingers: 1, ScanTime: true}
+	d := controllers.NewHIDDescriptor(&config.DeviceConfig{Width: 1080, Height: 2400, HID: opts})
+	pointers := []controllers.PointerStatus{{X: 100, Y: 200, OnScreen: true}}
+
+	// the release of a pause is encoded at timestamp 0, the scan time still goes forward
+	report := d.Report(pointers, 0)
+	stamped := d.StampScanTime(report, 6900*time.Millisecond)
+	assertBytes(t, stamped, []byte{0x30, 0x64, 0x00, 0xc8, 0x00, 0x88, 0x0d})
+	assertBytes(t, report, []byte{0x30, 0x64, 0x00, 0xc8, 0x00, 0x00, 0x00})
+
+	classic := controllers.NewHIDDescriptor(&config.DeviceConfig{Width: 1080, Height: 2400})
+	report = classic.Report(pointers, 0)
+	assertBytes(t, classic.StampScanTime(report, time.Second), report)
+}
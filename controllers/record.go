@@ -0,0 +1,244 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/stage"
+)
+
+// RecordController pretends to be a device. Payloads are generated the same way
+// as the `hid` or `adb` backend would, then decoded back to touch events and
+// written to a file as JSON lines, together with the time they were sent.
+//
+// Every payload produced by Preprocess carries its intended timestamp
+// (8 bytes, big endian, milliseconds) in front of the backend payload.
+type RecordController struct {
+	encoder Controller
+	decode  func(c *RecordController, data []byte) []*RecordedTouch
+	fingers []PointerStatus
+
+	file   *os.File
+	writer *bufio.Writer
+	opened time.Time
+}
+
+type RecordedTouch struct {
+	PointerID int    `json:"pointerId"`
+	Action    string `json:"action"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+}
+
+type RecordedSend struct {
+	Wall     time.Time        `json:"wall"`
+	Elapsed  int64            `json:"elapsed"`  // microseconds since the controller was opened
+	Intended int64            `json:"intended"` // milliseconds, chart time, -1 when every finger is released
+	Size     int              `json:"size"`
+	Events   []*RecordedTouch `json:"events"`
+}
+
+const recordHeaderSize = 8
+
+func newRecordController(path string, encoder Controller, decode func(c *RecordController, data []byte) []*RecordedTouch) (*RecordController, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordController{
+		encoder: encoder,
+		decode:  decode,
+		fingers: make([]PointerStatus, maxHIDFingers),
+		file:    file,
+		writer:  bufio.NewWriter(file),
+		opened:  time.Now(),
+	}, nil
+}
+
+func decodeHIDReport(c *RecordController, data []byte) []*RecordedTouch {
+	stride := c.encoder.(*HIDController).descriptor.fingerSize()
+	result := []*RecordedTouch{}
+	for i := 0; i+stride <= len(data); i += stride {
+		id := int(data[i] & 0b1111)
+		if id >= len(c.fingers) {
+			continue
+		}
+
+		status := PointerStatus{
+			X:        int(binary.LittleEndian.Uint16(data[i+1:])),
+			Y:        int(binary.LittleEndian.Uint16(data[i+3:])),
+			OnScreen: data[i]&0b110000 != 0,
+		}
+
+		prev := c.fingers[id]
+		c.fingers[id] = status
+
+		var action common.TouchAction
+		switch {
+		case !prev.OnScreen && status.OnScreen:
+			action = common.TouchDown
+		case prev.OnScreen && !status.OnScreen:
+			action = common.TouchUp
+		case status.OnScreen && (prev.X != status.X || prev.Y != status.Y):
+			action = common.TouchMove
+		default:
+			continue
+		}
+
+		result = append(result, &RecordedTouch{
+			PointerID: id,
+			Action:    action.String(),
+			X:         status.X,
+			Y:         status.Y,
+		})
+	}
+	return result
+}
+
+func decodeScrcpyMessages(_ *RecordController, data []byte) []*RecordedTouch {
+	result := []*RecordedTouch{}
+	for i := 0; i+32 <= len(data); i += 32 {
+		msg := data[i : i+32]
+		if msg[0] != 2 { // SC_CONTROL_MSG_TYPE_INJECT_TOUCH_EVENT
+			continue
+		}
+
+		result = append(result, &RecordedTouch{
+			PointerID: int(binary.BigEndian.Uint64(msg[2:])),
+			Action:    common.TouchAction(msg[1]).String(),
+			X:         int(int32(binary.BigEndian.Uint32(msg[10:]))),
+			Y:         int(int32(binary.BigEndian.Uint32(msg[14:]))),
+		})
+	}
+	return result
+}
+
+func (c *RecordController) Size() (int, int) {
+	return c.encoder.Size()
+}
+
+func (c *RecordController) Preprocess(rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error) {
+	result, err := c.encoder.Preprocess(rawEvents, calc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range result {
+		data := make([]byte, recordHeaderSize+len(item.Data))
+		binary.BigEndian.PutUint64(data, uint64(item.Timestamp))
+		copy(data[recordHeaderSize:], item.Data)
+		result[i].Data = data
+	}
+	return result, nil
+}
+
+func (c *RecordController) Send(data []byte) error {
+	if len(data) < recordHeaderSize {
+		return fmt.Errorf("payload too short: %d bytes", len(data))
+	}
+
+	payload := data[recordHeaderSize:]
+	if encoder, ok := c.encoder.(*ScrcpyController); ok {
+		// as the `adb` backend would send it
+		payload = encoder.track(payload)
+		if len(payload) == 0 {
+			return nil
+		}
+	}
+	return c.write(int64(binary.BigEndian.Uint64(data)), payload)
+}
+
+// ReleaseAll records the payload the backend would send to lift every finger, its intended time is -1
+func (c *RecordController) ReleaseAll() error {
+	var payload []byte
+	switch encoder := c.encoder.(type) {
+	case *HIDController:
+		payload = encoder.release()
+	case *ScrcpyController:
+		payload = encoder.track(encoder.release())
+	}
+
+	if len(payload) == 0 {
+		return nil
+	}
+	return c.write(-1, payload)
+}
+
+func (c *RecordController) write(intended int64, payload []byte) error {
+	now := time.Now()
+	record := &RecordedSend{
+		Wall:     now,
+		Elapsed:  now.Sub(c.opened).Microseconds(),
+		Intended: intended,
+		Size:     len(payload),
+		Events:   c.decode(c, payload),
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.writer.Write(line); err != nil {
+		return err
+	}
+
+	return c.writer.WriteByte('\n')
+}
+
+func (c *RecordController) Close() error {
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+
+	return c.file.Close()
+}
+
+type recordBackend struct {
+	hid bool
+}
+
+func (recordBackend) Devices() ([]string, error) {
+	return []string{"record"}, nil
+}
+
+func (b recordBackend) Open(serial string, opts *Options) (Controller, error) {
+	path := opts.RecordPath
+	if path == "" {
+		path = "record.jsonl"
+	}
+
+	if opts.Device.Width <= 0 || opts.Device.Height <= 0 {
+		return nil, fmt.Errorf("invalid screen size of device `%s`", serial)
+	}
+
+	if b.hid {
+		encoder := &HIDController{
+			dc:         opts.Device,
+			turnRight:  opts.TurnRight,
+			descriptor: NewHIDDescriptor(opts.Device),
+		}
+		return newRecordController(path, encoder, decodeHIDReport)
+	}
+
+	encoder := &ScrcpyController{
+		dc:     opts.Device,
+		width:  opts.Device.Height,
+		height: opts.Device.Width,
+	}
+	return newRecordController(path, encoder, decodeScrcpyMessages)
+}
+
+func init() {
+	Register("record-hid", recordBackend{hid: true})
+	Register("record-adb", recordBackend{hid: false})
+}
@@ -0,0 +1,213 @@
+package controllers_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/stage"
+)
+
+// a tap held from 0 to 200 ms, moving at 100 ms
+var heldTap = common.RawVirtualEvents{
+	{Timestamp: 0, Events: []*common.VirtualTouchEvent{{PointerID: 0, Action: common.TouchDown, X: 0.5, Y: 0}}},
+	{Timestamp: 100, Events: []*common.VirtualTouchEvent{{PointerID: 0, Action: common.TouchMove, X: 0.6, Y: 0}}},
+	{Timestamp: 200, Events: []*common.VirtualTouchEvent{{PointerID: 0, Action: common.TouchUp, X: 0.6, Y: 0}}},
+}
+
+func openRecord(t *testing.T, backend string) (controllers.Controller, []common.ViscousEventItem, string) {
+	t.Helper()
+
+	b, ok := controllers.Get(backend)
+	if !ok {
+		t.Fatalf("Backend %q not registered", backend)
+	}
+
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	c, err := b.Open("record", &controllers.Options{
+		Device:     &config.DeviceConfig{Serial: "record", Width: 1080, Height: 1920},
+		RecordPath: path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, _ := stage.Get("bang")
+	events, err := c.Preprocess(heldTap, spec.Layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, events, path
+}
+
+func readRecord(t *testing.T, path string) []*controllers.RecordedSend {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	result := []*controllers.RecordedSend{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record controllers.RecordedSend
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, &record)
+	}
+	return result
+}
+
+type recorded struct {
+	intended int64
+	action   string
+}
+
+func playReleased(t *testing.T, backend string) []recorded {
+	t.Helper()
+
+	c, events, path := openRecord(t, backend)
+	releaser, ok := c.(controllers.Releaser)
+	if !ok {
+		t.Fatalf("Backend %q cannot release the fingers", backend)
+	}
+
+	// the finger is released between the down and the move, e.g. paused
+	steps := []func() error{
+		func() error { return c.Send(events[0].Data) },
+		releaser.ReleaseAll,
+		func() error { return c.Send(events[1].Data) },
+		func() error { return c.Send(events[2].Data) },
+		releaser.ReleaseAll,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := []recorded{}
+	for _, record := range readRecord(t, path) {
+		for _, touch := range record.Events {
+			result = append(result, recorded{record.Intended, touch.Action})
+		}
+	}
+	return result
+}
+
+func expectRecorded(t *testing.T, got, want []recorded) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("Recorded %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Recorded %v, want %v", got, want)
+			return
+		}
+	}
+}
+
+func TestReleaseAllInjected(t *testing.T) {
+	// the move puts the released finger down again, nothing is left to release at the end
+	expectRecorded(t, playReleased(t, "record-adb"), []recorded{
+		{0, "down"},
+		{-1, "up"},
+		{100, "down"},
+		{200, "up"},
+	})
+}
+
+func TestReleaseAllHID(t *testing.T) {
+	// reports carry the complete touch state
+	expectRecorded(t, playReleased(t, "record-hid"), []recorded{
+		{0, "down"},
+		{-1, "up"},
+		{100, "down"},
+		{200, "up"},
+	})
+}
+
+func TestFlickDepthInjected(t *testing.T) {
+	b, _ := controllers.Get("record-adb")
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	c, err := b.Open("record", &controllers.Options{
+		Device:     &config.DeviceConfig{Serial: "record", Width: 1080, Height: 1920},
+		RecordPath: path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a flick tail 0.2 judge line widths up from the judge line
+	spec, _ := stage.Get("bang")
+	events, err := c.Preprocess(common.RawVirtualEvents{
+		{Timestamp: 0, Events: []*common.VirtualTouchEvent{{PointerID: 0, Action: common.TouchDown, X: 0.5, Y: 0}}},
+		{Timestamp: 50, Events: []*common.VirtualTouchEvent{{PointerID: 0, Action: common.TouchMove, X: 0.5, Y: 0.2}}},
+		{Timestamp: 60, Events: []*common.VirtualTouchEvent{{PointerID: 0, Action: common.TouchUp, X: 0.5, Y: 0.2}}},
+	}, spec.Layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range events {
+		if err := c.Send(event.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readRecord(t, path)
+	down, move := records[0].Events[0], records[1].Events[0]
+
+	// the depth is in judge line widths as on the hid backend, it used to be in (judgeY - height/2)
+	layout := spec.Layout(1920, 1080)
+	_, y0 := layout.Project(0.5, 0)
+	_, y1 := layout.Project(0.5, 0.2)
+	if d := float64(down.Y-move.Y) - (y0 - y1); d < -1 || d > 1 {
+		t.Errorf("Flicked %d pixels up, want %.0f", down.Y-move.Y, y0-y1)
+	}
+	if old := 0.2 * (layout.JudgeY - 540); float64(down.Y-move.Y) < 2*old {
+		t.Errorf("Flicked %d pixels up, about as far as %.0f before", down.Y-move.Y, old)
+	}
+}
+
+func TestPointerOutOfRange(t *testing.T) {
+	for _, backend := range []string{"record-adb", "record-hid"} {
+		for _, id := range []int{-1, 10} {
+			b, _ := controllers.Get(backend)
+			c, err := b.Open("record", &controllers.Options{
+				Device:     &config.DeviceConfig{Serial: "record", Width: 1080, Height: 1920},
+				RecordPath: filepath.Join(t.TempDir(), "record.jsonl"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec, _ := stage.Get("bang")
+			_, err = c.Preprocess(common.RawVirtualEvents{
+				{Timestamp: 0, Events: []*common.VirtualTouchEvent{{PointerID: id, Action: common.TouchDown, X: 0.5, Y: 0}}},
+			}, spec.Layout)
+			if !errors.Is(err, common.ErrInvalidEventStream) {
+				t.Errorf("%s with pointer %d: got %v, want ErrInvalidEventStream", backend, id, err)
+			}
+			c.Close()
+		}
+	}
+}
@@ -6,10 +6,13 @@ package controllers
 import (
 	"encoding/binary"
 	"fmt"
-	"math"
+	"io"
 	"math/rand"
 	"net"
 	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/kvarenzn/ssm/adb"
 	"github.com/kvarenzn/ssm/common"
@@ -17,31 +20,68 @@ import (
 	"github.com/kvarenzn/ssm/decoders/av"
 	"github.com/kvarenzn/ssm/log"
 	"github.com/kvarenzn/ssm/stage"
+	"github.com/kvarenzn/ssm/utils"
 )
 
 type ScrcpyController struct {
 	device    *adb.Device
+	dc        *config.DeviceConfig
 	sessionID string
 
+	options       *config.ScrcpyOptions
 	listener      net.Listener
 	videoSocket   net.Conn
+	audioSocket   net.Conn
 	controlSocket net.Conn
 
-	width    int
-	height   int
+	// size of the video frames, the same as the current screen, guarded by mutex
+	width       int
+	height      int
+	latestFrame *av.Frame
+	mutex       sync.Mutex
+	frames      chan *av.Frame
+	audio       chan *av.AudioFrame
+
+	turnRight bool
+	calc      stage.LayoutCalculator // from the last Preprocess, used to remap events after resize or rotation
+	uhid      *HIDDescriptor         // the virtual touchscreen, nil if touches are injected
+	uhidSince time.Time              // scan times of the virtual touchscreen are counted from here
+	touches   map[uint64][]byte      // the last message of each injected pointer on screen
+
+	messages chan *DeviceMessage
+
+	videoPath string // record the screen to this file if not empty
+	recorder  *av.Recorder
+	videoDone chan struct{} // closed when the video stream ends, nil if it never started
+
 	codecID  string
 	decoder  *av.AVDecoder
 	cRunning bool
 	vRunning bool
 }
 
-func NewScrcpyController(device *adb.Device) *ScrcpyController {
+func NewScrcpyController(device *adb.Device, dc *config.DeviceConfig) *ScrcpyController {
 	return &ScrcpyController{
 		device:    device,
+		dc:        dc,
 		sessionID: fmt.Sprintf("%08x", rand.Int31()),
+		messages:  make(chan *DeviceMessage, deviceMessageBuffer),
+		frames:    make(chan *av.Frame, 1),
+		audio:     make(chan *av.AudioFrame, audioFrameBuffer),
 	}
 }
 
+const (
+	deviceMessageBuffer = 16
+	audioFrameBuffer    = 256 // about 5 seconds of 20ms frames
+)
+
+// Messages returns the messages sent by the device, the channel is closed when the control socket is closed.
+// Messages are dropped if the channel is full.
+func (c *ScrcpyController) Messages() <-chan *DeviceMessage {
+	return c.messages
+}
+
 func tryListen(host string, port int) (net.Listener, int) {
 	for {
 		addr := fmt.Sprintf("%s:%d", host, port)
@@ -56,7 +96,20 @@ func tryListen(host string, port int) (net.Listener, int) {
 
 const testFromPort = 27188
 
-func (c *ScrcpyController) Open(filepath string, version string) error {
+func (c *ScrcpyController) accept(name string) (net.Conn, error) {
+	conn, err := c.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("%s socket accepted.", name)
+	return conn, nil
+}
+
+func (c *ScrcpyController) Open(opts *config.ScrcpyOptions) error {
+	opts = WithScrcpyDefaults(opts)
+	c.options = opts
+
 	listener, port := tryListen("localhost", testFromPort)
 	c.listener = listener
 	log.Debugf("Listening at localhost:%d", port)
@@ -68,7 +121,7 @@ func (c *ScrcpyController) Open(filepath string, version string) error {
 	}
 	log.Debugf("ADB reverse socket `%s` created.", localName)
 
-	f, err := os.Open(filepath)
+	f, err := os.Open(opts.ServerPath)
 	if err != nil {
 		return err
 	}
@@ -82,39 +135,46 @@ func (c *ScrcpyController) Open(filepath string, version string) error {
 	log.Debugln("`scrcpy-server` pushed to gaming device.")
 
 	go func() {
-		result, err := c.device.Sh(
-			"CLASSPATH=/data/local/tmp/scrcpy-server.jar",
-			"app_process",
+		args := append([]string{
 			"/",
 			"com.genymobile.scrcpy.Server",
-			version,
-			fmt.Sprintf("scid=%s", c.sessionID), // session id
-			"log_level=info",                    // log level
-			"audio=false",                       // disable audio sync
-			"clipboard_autosync=false",          // disable clipboard
-		)
+		}, scrcpyServerArgs(opts, c.sessionID)...)
+		result, err := c.device.Sh("CLASSPATH=/data/local/tmp/scrcpy-server.jar", append([]string{"app_process"}, args...)...)
 		if err != nil {
-			log.Fatalln("Failed to start `scrcpy-server`:", err)
+			// unblock the pending Accept()s below
+			log.Warn("Failed to start `scrcpy-server`:", err)
+			listener.Close()
+			return
 		}
 
 		log.Debugln(result)
 	}()
 
-	videoSocket, err := listener.Accept()
-	if err != nil {
-		return err
+	// the server connects in this order, the device name is sent through the first socket
+	var first net.Conn
+	if !opts.NoVideo {
+		if c.videoSocket, err = c.accept("Video"); err != nil {
+			return err
+		}
+		first = c.videoSocket
 	}
-	c.videoSocket = videoSocket
 
-	log.Debugln("Video socket accepted.")
+	if opts.AudioSource != "" {
+		if c.audioSocket, err = c.accept("Audio"); err != nil {
+			return err
+		}
+		if first == nil {
+			first = c.audioSocket
+		}
+	}
 
-	controlSocket, err := listener.Accept()
-	if err != nil {
+	if c.controlSocket, err = c.accept("Control"); err != nil {
 		return err
 	}
-	c.controlSocket = controlSocket
-
-	log.Debugln("Control socket accepted.")
+	if first == nil {
+		first = c.controlSocket
+	}
+	controlSocket := c.controlSocket
 
 	err = c.device.Client().KillForward(localName, true)
 	if err != nil {
@@ -124,116 +184,484 @@ func (c *ScrcpyController) Open(filepath string, version string) error {
 	log.Debugf("ADB reverse socket `%s` removed.", localName)
 
 	deviceName := make([]byte, 64)
-	videoSocket.Read(deviceName)
-
-	buf := make([]byte, 4)
-	videoSocket.Read(buf)
-	c.codecID = string(buf)
-
-	c.decoder, err = av.NewAVDecoder(c.codecID)
-	if err != nil {
+	if _, err := io.ReadFull(first, deviceName); err != nil {
 		return err
 	}
 
-	videoSocket.Read(buf)
-	c.width = int(binary.BigEndian.Uint32(buf))
+	if opts.NoVideo {
+		// nothing is reported, trust the config
+		c.width, c.height = c.dc.Height, c.dc.Width
+	} else {
+		header := make([]byte, 12)
+		if _, err := io.ReadFull(c.videoSocket, header); err != nil {
+			return err
+		}
+
+		c.codecID = string(header[:4])
+		c.decoder, err = av.NewAVDecoder(c.codecID)
+		if err != nil {
+			return err
+		}
+
+		c.width = int(binary.BigEndian.Uint32(header[4:]))
+		c.height = int(binary.BigEndian.Uint32(header[8:]))
 
-	videoSocket.Read(buf)
-	c.height = int(binary.BigEndian.Uint32(buf))
+		if c.videoPath != "" {
+			if c.recorder, err = av.NewRecorder(c.videoPath, c.codecID, c.width, c.height); err != nil {
+				return err
+			}
+			log.Debugln("Recording screen to", c.videoPath)
+		}
+	}
 
 	c.cRunning = true
 	c.vRunning = true
 
 	go func() {
-		msgTypeBuf := make([]byte, 1)
-		sizeBuf := make([]byte, 4)
+		defer close(c.messages)
 		for c.cRunning {
-			if n, err := controlSocket.Read(msgTypeBuf); err != nil || n != 1 {
-				break
-			}
-
-			if n, err := controlSocket.Read(sizeBuf); err != nil || n != 4 {
+			msg, err := ReadDeviceMessage(controlSocket)
+			if err != nil {
+				if c.cRunning {
+					log.Debugln("Failed to read device message:", err)
+				}
 				break
 			}
 
-			size := binary.BigEndian.Uint32(sizeBuf)
-			bodyBuf := make([]byte, size)
-			if n, err := controlSocket.Read(bodyBuf); err != nil || n != int(size) {
-				break
+			select {
+			case c.messages <- msg:
+			default:
+				log.Debugln("Device message dropped:", msg.Type)
 			}
 		}
 
 		c.cRunning = false
 	}()
 
-	go func() {
-		ptsBuf := make([]byte, 8)
-		sizeBuf := make([]byte, 4)
-		for c.vRunning {
-			if n, err := videoSocket.Read(ptsBuf); err != nil || n != 8 {
-				break
-			}
+	if c.videoSocket != nil {
+		c.videoDone = make(chan struct{})
+		go c.receiveVideo(c.videoSocket)
+	}
 
-			pts := binary.BigEndian.Uint64(ptsBuf)
+	if c.audioSocket != nil {
+		go c.receiveAudio(c.audioSocket)
+	}
 
-			if n, err := videoSocket.Read(sizeBuf); err != nil || n != 4 {
-				break
-			}
+	return nil
+}
 
-			size := binary.BigEndian.Uint32(sizeBuf)
+// readPacket reads a packet of the video or audio stream
+func readPacket(r io.Reader) (uint64, []byte, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
 
-			data := make([]byte, size)
+	data := make([]byte, binary.BigEndian.Uint32(header[8:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
 
-			if n, err := videoSocket.Read(data); err != nil || n != int(size) {
-				break
+	return binary.BigEndian.Uint64(header), data, nil
+}
+
+// RemuxVideoDump remuxes a dump of the video socket (the codec header and the packets that follow it) into a file,
+// the same way the screen is recorded during a session.
+func RemuxVideoDump(r io.Reader, path string) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+
+	width, height := int(binary.BigEndian.Uint32(header[4:])), int(binary.BigEndian.Uint32(header[8:]))
+	recorder, err := av.NewRecorder(path, string(header[:4]), width, height)
+	if err != nil {
+		return err
+	}
+
+	for {
+		pts, data, err := readPacket(r)
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil {
+			err = recorder.Write(pts, data)
+		}
+
+		if err != nil {
+			recorder.Close()
+			return err
+		}
+	}
+
+	return recorder.Close()
+}
+
+func (c *ScrcpyController) receiveVideo(videoSocket net.Conn) {
+	defer close(c.videoDone)
+
+	for c.vRunning {
+		pts, data, err := readPacket(videoSocket)
+		if err != nil {
+			break
+		}
+		received := time.Now()
+
+		if c.recorder != nil {
+			if err := c.recorder.Write(pts, data); err != nil {
+				log.Warn("Failed to record screen:", err)
+				c.recorder.Close()
+				c.recorder = nil
 			}
+		}
 
-			c.decoder.Decode(pts, data)
+		frames, err := c.decoder.Decode(pts, data)
+		if err != nil {
+			log.Debugln("Failed to decode video packet:", err)
 		}
 
-		c.vRunning = false
-	}()
+		for _, frame := range frames {
+			frame.Received = received
+			bounds := frame.Image.Bounds()
+			c.setGeometry(bounds.Dx(), bounds.Dy())
+			c.publishFrame(frame)
+		}
+	}
 
-	return nil
+	c.vRunning = false
+	close(c.frames)
+
+	if c.recorder != nil {
+		if err := c.recorder.Close(); err != nil {
+			log.Warn("Failed to record screen:", err)
+		}
+		c.recorder = nil
+	}
 }
 
-func (c *ScrcpyController) Encode(action common.TouchAction, x, y int32, pointerID uint64) []byte {
+// publishFrame replaces the latest frame, a frame not yet received from the channel is dropped as stale
+func (c *ScrcpyController) publishFrame(frame *av.Frame) {
+	c.mutex.Lock()
+	c.latestFrame = frame
+	c.mutex.Unlock()
+
+	for {
+		select {
+		case c.frames <- frame:
+			return
+		default:
+		}
+
+		select {
+		case <-c.frames:
+		default:
+		}
+	}
+}
+
+// LatestFrame returns the most recently decoded frame, nil before the first one
+func (c *ScrcpyController) LatestFrame() *av.Frame {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.latestFrame
+}
+
+// HasVideo reports whether the screen is streamed, it is not with the `noVideo` option
+func (c *ScrcpyController) HasVideo() bool {
+	return c.videoSocket != nil
+}
+
+// Frames returns the decoded frames, only the newest one is kept if the receiver falls behind.
+// The channel is closed when the video stream ends.
+func (c *ScrcpyController) Frames() <-chan *av.Frame {
+	return c.frames
+}
+
+// HasAudio reports whether the audio is streamed, it is only with the `audioSource` option
+func (c *ScrcpyController) HasAudio() bool {
+	return c.audioSocket != nil
+}
+
+// Audio returns the decoded audio, frames are dropped if the receiver falls behind.
+// The channel is closed when the audio stream ends.
+func (c *ScrcpyController) Audio() <-chan *av.AudioFrame {
+	return c.audio
+}
+
+// receiveAudio decodes the audio stream, the server is never blocked by it even if nobody listens
+func (c *ScrcpyController) receiveAudio(audioSocket net.Conn) {
+	defer close(c.audio)
+
+	codec := make([]byte, 4)
+	if _, err := io.ReadFull(audioSocket, codec); err != nil {
+		return
+	}
+
+	if binary.BigEndian.Uint32(codec) == 0 {
+		log.Debugln("Audio is not available on the device.")
+		return
+	}
+
+	decoder, err := av.NewAVDecoder(string(codec))
+	if err != nil {
+		log.Warn("Failed to decode audio:", err)
+	}
+
+	for c.vRunning {
+		pts, data, err := readPacket(audioSocket)
+		if err != nil {
+			break
+		}
+		received := time.Now()
+
+		if decoder == nil {
+			continue
+		}
+
+		frames, err := decoder.DecodeAudio(pts, data)
+		if err != nil {
+			log.Debugln("Failed to decode audio packet:", err)
+		}
+
+		for _, frame := range frames {
+			frame.Received = received
+			select {
+			case c.audio <- frame:
+			default:
+				log.Debugln("Audio frame dropped.")
+			}
+		}
+	}
+
+	if decoder != nil {
+		decoder.Drop()
+	}
+}
+
+func (c *ScrcpyController) geometry() (int, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.width, c.height
+}
+
+func (c *ScrcpyController) setGeometry(width, height int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.width != width || c.height != height {
+		log.Debugf("Screen geometry changed: %dx%d -> %dx%d", c.width, c.height, width, height)
+		c.width, c.height = width, height
+	}
+}
+
+func (c *ScrcpyController) encode(action common.TouchAction, x, y int32, pointerID uint64, width, height int) []byte {
 	data := make([]byte, 32)
 	data[0] = 2 // type: SC_CONTROL_MSG_TYPE_INJECT_TOUCH_EVENT
 	data[1] = byte(action)
 	binary.BigEndian.PutUint64(data[2:], pointerID)
 	binary.BigEndian.PutUint32(data[10:], uint32(x))
 	binary.BigEndian.PutUint32(data[14:], uint32(y))
-	binary.BigEndian.PutUint16(data[18:], uint16(c.width))
-	binary.BigEndian.PutUint16(data[20:], uint16(c.height))
+	binary.BigEndian.PutUint16(data[18:], uint16(width))
+	binary.BigEndian.PutUint16(data[20:], uint16(height))
 	binary.BigEndian.PutUint16(data[22:], 0xffff)
 	binary.BigEndian.PutUint32(data[24:], 1) // AMOTION_EVENT_BUTTON_PRIMARY
 	binary.BigEndian.PutUint32(data[28:], 1) // AMOTION_EVENT_BUTTON_PRIMARY
 	return data
 }
 
-func (c *ScrcpyController) touch(action common.TouchAction, x, y int32, pointerID uint64) {
-	c.Send(c.Encode(action, x, y, pointerID))
+func (c *ScrcpyController) Encode(action common.TouchAction, x, y int32, pointerID uint64) []byte {
+	width, height := c.geometry()
+	return c.encode(action, x, y, pointerID, width, height)
 }
 
-func (c *ScrcpyController) Down(pointerID uint64, x, y int) {
-	c.touch(common.TouchDown, int32(x), int32(y), pointerID)
+// toScreen maps a point on the stage to a screen of the given size.
+// The stage is always landscape, on a portrait screen it is rotated the same way as the `hid` backend does.
+func (c *ScrcpyController) toScreen(layout *stage.Layout, lane, depth float64, width, height int) (int, int) {
+	px, py := layout.Project(lane, depth)
+	long, short := max(width, height), min(width, height)
+	x, y := clamp(roundint(px), 0, long), clamp(roundint(py), 0, short)
+	if width >= height {
+		return x, y
+	}
+
+	if c.turnRight {
+		return y, long - x
+	}
+	return short - y, x
 }
 
-func (c *ScrcpyController) Move(pointerID uint64, x, y int) {
-	c.touch(common.TouchMove, int32(x), int32(y), pointerID)
+// toStage is the inverse of toScreen
+func (c *ScrcpyController) toStage(layout *stage.Layout, x, y int, width, height int) (float64, float64) {
+	long, short := max(width, height), min(width, height)
+	px, py := x, y
+	if width < height {
+		if c.turnRight {
+			px, py = long-y, x
+		} else {
+			px, py = y, short-x
+		}
+	}
+	return layout.Unproject(float64(px), float64(py))
 }
 
-func (c *ScrcpyController) Up(pointerID uint64, x, y int) {
-	c.touch(common.TouchUp, int32(x), int32(y), pointerID)
+func (c *ScrcpyController) landscapeLayout(width, height int) *stage.Layout {
+	return c.calc(float64(max(width, height)), float64(min(width, height)))
+}
+
+// remap re-encodes the touch messages that were encoded for another screen geometry, in place
+func (c *ScrcpyController) remap(data []byte) {
+	if c.calc == nil || c.uhid != nil {
+		return
+	}
+
+	width, height := c.geometry()
+	layouts := map[[2]int]*stage.Layout{}
+	layout := c.landscapeLayout(width, height)
+	for i := 0; i+32 <= len(data); i += 32 {
+		msg := data[i : i+32]
+		if msg[0] != 2 { // SC_CONTROL_MSG_TYPE_INJECT_TOUCH_EVENT
+			continue
+		}
+
+		w, h := int(binary.BigEndian.Uint16(msg[18:])), int(binary.BigEndian.Uint16(msg[20:]))
+		if w == width && h == height {
+			continue
+		}
+
+		old, ok := layouts[[2]int{w, h}]
+		if !ok {
+			old = c.landscapeLayout(w, h)
+			layouts[[2]int{w, h}] = old
+		}
+
+		x, y := int(int32(binary.BigEndian.Uint32(msg[10:]))), int(int32(binary.BigEndian.Uint32(msg[14:])))
+		lane, depth := c.toStage(old, x, y, w, h)
+		nx, ny := c.toScreen(layout, lane, depth, width, height)
+		copy(msg, c.encode(common.TouchAction(msg[1]), int32(nx), int32(ny), binary.BigEndian.Uint64(msg[2:]), width, height))
+	}
+}
+
+// isTouchMessages reports whether data consists of INJECT_TOUCH_EVENT messages only
+func isTouchMessages(data []byte) bool {
+	if len(data) == 0 || len(data)%32 != 0 {
+		return false
+	}
+
+	for i := 0; i < len(data); i += 32 {
+		if data[i] != 2 { // SC_CONTROL_MSG_TYPE_INJECT_TOUCH_EVENT
+			return false
+		}
+	}
+	return true
+}
+
+// track keeps the injected touches consistent when payloads are skipped (seek, reconnect) or the pointers are released in between:
+// a move of a pointer that is not on screen puts it down, its up is dropped, and a down of a pointer on screen moves it.
+// data is left untouched, a fixed copy is returned if needed.
+func (c *ScrcpyController) track(data []byte) []byte {
+	if c.uhid != nil || !isTouchMessages(data) {
+		return data
+	}
+
+	if c.touches == nil {
+		c.touches = map[uint64][]byte{}
+	}
+
+	result := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i += 32 {
+		msg := slices.Clone(data[i : i+32])
+		pointerID := binary.BigEndian.Uint64(msg[2:])
+		_, down := c.touches[pointerID]
+
+		switch action := common.TouchAction(msg[1]); {
+		case action == common.TouchDown && down:
+			msg[1] = byte(common.TouchMove)
+		case action == common.TouchMove && !down:
+			msg[1] = byte(common.TouchDown)
+		case action == common.TouchUp && !down:
+			continue
+		}
+
+		if common.TouchAction(msg[1]) == common.TouchUp {
+			delete(c.touches, pointerID)
+		} else {
+			c.touches[pointerID] = msg
+		}
+		result = append(result, msg...)
+	}
+	return result
+}
+
+// release returns the messages that lift every pointer on screen
+func (c *ScrcpyController) release() []byte {
+	if c.uhid != nil {
+		return encodeUHIDInput(uhidTouchscreenID, genHIDEventData(c.uhid, nil, 0))
+	}
+
+	var data []byte
+	for _, pointerID := range utils.SortedKeysOf(c.touches) {
+		msg := slices.Clone(c.touches[pointerID])
+		msg[1] = byte(common.TouchUp)
+		data = append(data, msg...)
+	}
+	return data
+}
+
+// ReleaseAll lifts every pointer on screen
+func (c *ScrcpyController) ReleaseAll() error {
+	data := c.release()
+	if len(data) == 0 {
+		return nil
+	}
+	return c.Send(data)
+}
+
+func (c *ScrcpyController) touch(action common.TouchAction, x, y int32, pointerID uint64) error {
+	return c.Send(c.Encode(action, x, y, pointerID))
+}
+
+func (c *ScrcpyController) Down(pointerID uint64, x, y int) error {
+	return c.touch(common.TouchDown, int32(x), int32(y), pointerID)
+}
+
+func (c *ScrcpyController) Move(pointerID uint64, x, y int) error {
+	return c.touch(common.TouchMove, int32(x), int32(y), pointerID)
+}
+
+func (c *ScrcpyController) Up(pointerID uint64, x, y int) error {
+	return c.touch(common.TouchUp, int32(x), int32(y), pointerID)
 }
 
 func (c *ScrcpyController) Close() error {
+	// the UHID touchscreen lifts its fingers before it is destroyed
+	if c.uhid == nil {
+		if err := c.ReleaseAll(); err != nil {
+			log.Debugln("Failed to release the pointers:", err)
+		}
+	}
+
+	if err := c.closeUHID(); err != nil {
+		log.Debugln("Failed to destroy UHID touchscreen:", err)
+	}
+
 	c.cRunning = false
 	c.vRunning = false
 
-	if err := c.videoSocket.Close(); err != nil {
-		return err
+	if c.videoSocket != nil {
+		if err := c.videoSocket.Close(); err != nil {
+			return err
+		}
+
+		// wait for the recording to be finished
+		if c.videoDone != nil {
+			<-c.videoDone
+		}
+	}
+
+	if c.audioSocket != nil {
+		if err := c.audioSocket.Close(); err != nil {
+			return err
+		}
 	}
 
 	if err := c.controlSocket.Close(); err != nil {
@@ -243,39 +671,51 @@ func (c *ScrcpyController) Close() error {
 	return c.listener.Close()
 }
 
-func (c *ScrcpyController) Preprocess(rawEvents common.RawVirtualEvents, turnRight bool, dc *config.DeviceConfig, calc stage.JudgeLinePositionCalculator) []common.ViscousEventItem {
-	width, height := float64(dc.Height), float64(dc.Width)
-	x1, x2, yy := calc(width, height)
-	mapper := func(x, y float64) (int, int) {
-		return int(math.Round(x1 + (x2-x1)*x)), int(math.Round(yy - (yy-height/2)*y))
+func (c *ScrcpyController) Size() (int, int) {
+	width, height := c.geometry()
+	return min(width, height), max(width, height)
+}
+
+func (c *ScrcpyController) Preprocess(rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error) {
+	if c.uhid != nil {
+		return c.preprocessUHID(rawEvents, calc)
 	}
 
+	// map with the real screen geometry reported by the server, events are remapped in Send if it changes later
+	c.calc = calc
+	width, height := c.geometry()
+	layout := c.landscapeLayout(width, height)
+
 	result := []common.ViscousEventItem{}
 	currentFingers := make([]bool, 10)
 	for _, events := range rawEvents {
 		var data []byte
 		for _, event := range events.Events {
-			x, y := mapper(event.X, event.Y)
+			if event.PointerID < 0 || event.PointerID >= len(currentFingers) {
+				return nil, fmt.Errorf("%w: pointer `%d` exceeds the %d fingers that are tracked", common.ErrInvalidEventStream, event.PointerID, len(currentFingers))
+			}
+
+			x, y := c.toScreen(layout, event.X, event.Y, width, height)
 			switch event.Action {
 			case common.TouchDown:
 				if currentFingers[event.PointerID] {
-					log.Fatalf("pointer `%d` is already on screen", event.PointerID)
+					return nil, fmt.Errorf("%w: pointer `%d` is already on screen", common.ErrInvalidEventStream, event.PointerID)
 				}
 				currentFingers[event.PointerID] = true
 			case common.TouchMove:
 				if !currentFingers[event.PointerID] {
-					log.Fatalf("pointer `%d` is not on screen", event.PointerID)
+					return nil, fmt.Errorf("%w: pointer `%d` is not on screen", common.ErrInvalidEventStream, event.PointerID)
 				}
 			case common.TouchUp:
 				if !currentFingers[event.PointerID] {
-					log.Fatalf("pointer `%d` is not on screen", event.PointerID)
+					return nil, fmt.Errorf("%w: pointer `%d` is not on screen", common.ErrInvalidEventStream, event.PointerID)
 				}
 				currentFingers[event.PointerID] = false
 			default:
-				log.Fatalf("unknown touch action: %d\n", event.Action)
+				return nil, fmt.Errorf("%w: unknown touch action: %d", common.ErrInvalidEventStream, event.Action)
 			}
 
-			data = append(data, c.Encode(event.Action, int32(x), int32(y), uint64(event.PointerID))...)
+			data = append(data, c.encode(event.Action, int32(x), int32(y), uint64(event.PointerID), width, height)...)
 		}
 
 		result = append(result, common.ViscousEventItem{
@@ -284,16 +724,136 @@ func (c *ScrcpyController) Preprocess(rawEvents common.RawVirtualEvents, turnRig
 		})
 	}
 
-	return result
+	return result, nil
 }
 
-func (c *ScrcpyController) Send(data []byte) {
+func (c *ScrcpyController) Send(data []byte) error {
+	c.remap(data)
+	data = c.stampScanTime(c.track(data))
+	if len(data) == 0 {
+		return nil
+	}
+
 	n, err := c.controlSocket.Write(data)
 	if err != nil {
-		log.Fatalln("Failed to send control data through control socket:", err)
+		return wrapSocketError(err)
 	}
 
 	if n != len(data) {
-		log.Fatalf("Failed to send control data through control socket: expect to send %d bytes, but %d bytes were sent", len(data), n)
+		return fmt.Errorf("%w: expect to send %d bytes, but %d bytes were sent", ErrDeviceDisconnected, len(data), n)
+	}
+
+	return nil
+}
+
+type adbBackend struct{}
+
+func (adbBackend) client() (*adb.Client, error) {
+	if err := adb.StartADBServer("localhost", 5037); err != nil && err != adb.ErrADBServerRunning {
+		return nil, err
 	}
+
+	return adb.NewDefaultClient(), nil
+}
+
+func (b adbBackend) Devices() ([]string, error) {
+	client, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugln("ADB devices:", devices)
+
+	result := []string{}
+	for _, d := range devices {
+		if d.Authorized() {
+			result = append(result, d.Serial())
+		}
+	}
+	return result, nil
+}
+
+func (b adbBackend) device(serial string) (*adb.Device, error) {
+	client, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	var device *adb.Device
+	for _, d := range devices {
+		if d.Serial() == serial {
+			device = d
+			break
+		}
+	}
+
+	if device == nil {
+		return nil, fmt.Errorf("no device has serial `%s`", serial)
+	}
+
+	if !device.Authorized() {
+		return nil, fmt.Errorf("found device with serial number `%s`, but that device is not authorized", serial)
+	}
+
+	return device, nil
+}
+
+func (b adbBackend) Open(serial string, opts *Options) (Controller, error) {
+	device, err := b.device(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugln("Selected device:", device)
+	c := NewScrcpyController(device, opts.Device)
+	c.turnRight = opts.TurnRight
+	c.videoPath = opts.VideoPath
+	if err := c.Open(opts.Scrcpy); err != nil {
+		return nil, err
+	}
+
+	if opts.UHID {
+		if err := c.OpenUHID(); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	// an unscaled video stream has the real screen size, touches are mapped with it
+	if width, height := c.Size(); c.options.MaxSize == 0 && !c.options.NoVideo && (width != opts.Device.Width || height != opts.Device.Height) {
+		log.Warnf("Screen size of device [%s] is %dx%d, but %dx%d is saved in config, the former is used", serial, width, height, opts.Device.Width, opts.Device.Height)
+	}
+
+	return c, nil
+}
+
+// ProbeScreenSize queries the screen size of the device through adb.
+// A device connected with USB has the same serial in the `hid` backend, so it works for both.
+func ProbeScreenSize(serial string) (int, int, error) {
+	device, err := adbBackend{}.device(serial)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info, err := device.DisplayInfo()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	log.Debugf("Display of device [%s]: %dx%d, density %d, rotation %d", serial, info.Width, info.Height, info.Density, info.Rotation)
+	return info.Width, info.Height, nil
+}
+
+func init() {
+	Register("adb", adbBackend{})
 }
@@ -0,0 +1,108 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DeviceMessageType is the type of the messages scrcpy-server sends through the control socket
+type DeviceMessageType byte
+
+const (
+	DeviceMessageClipboard    DeviceMessageType = 0 // DEVICE_MSG_TYPE_CLIPBOARD
+	DeviceMessageAckClipboard DeviceMessageType = 1 // DEVICE_MSG_TYPE_ACK_CLIPBOARD
+	DeviceMessageUHIDOutput   DeviceMessageType = 2 // DEVICE_MSG_TYPE_UHID_OUTPUT
+)
+
+func (t DeviceMessageType) String() string {
+	switch t {
+	case DeviceMessageClipboard:
+		return "clipboard"
+	case DeviceMessageAckClipboard:
+		return "ack-clipboard"
+	case DeviceMessageUHIDOutput:
+		return "uhid-output"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// DeviceMessage is a decoded device message, only the fields of its type are set
+type DeviceMessage struct {
+	Type DeviceMessageType
+
+	Text     string // clipboard
+	Sequence uint64 // ack-clipboard
+	UHIDID   uint16 // uhid-output
+	Data     []byte // uhid-output
+}
+
+var ErrUnknownDeviceMessage = errors.New("unknown scrcpy device message")
+
+// max size of a clipboard text, same as the limit of scrcpy
+const maxClipboardLength = 1 << 18
+
+// ReadDeviceMessage reads exactly one device message.
+// A stream that ends in the middle of a message fails with io.ErrUnexpectedEOF.
+func ReadDeviceMessage(r io.Reader) (*DeviceMessage, error) {
+	typeBuf := make([]byte, 1)
+	if _, err := io.ReadFull(r, typeBuf); err != nil {
+		return nil, err
+	}
+
+	// the type byte is read, so running out of data from now on is unexpected
+	readFull := func(buf []byte) error {
+		_, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	msg := &DeviceMessage{Type: DeviceMessageType(typeBuf[0])}
+	switch msg.Type {
+	case DeviceMessageClipboard:
+		lengthBuf := make([]byte, 4)
+		if err := readFull(lengthBuf); err != nil {
+			return nil, err
+		}
+
+		length := binary.BigEndian.Uint32(lengthBuf)
+		if length > maxClipboardLength {
+			return nil, fmt.Errorf("clipboard text too long: %d bytes", length)
+		}
+
+		text := make([]byte, length)
+		if err := readFull(text); err != nil {
+			return nil, err
+		}
+		msg.Text = string(text)
+	case DeviceMessageAckClipboard:
+		sequenceBuf := make([]byte, 8)
+		if err := readFull(sequenceBuf); err != nil {
+			return nil, err
+		}
+		msg.Sequence = binary.BigEndian.Uint64(sequenceBuf)
+	case DeviceMessageUHIDOutput:
+		header := make([]byte, 4)
+		if err := readFull(header); err != nil {
+			return nil, err
+		}
+		msg.UHIDID = binary.BigEndian.Uint16(header)
+
+		msg.Data = make([]byte, binary.BigEndian.Uint16(header[2:]))
+		if err := readFull(msg.Data); err != nil {
+			return nil, err
+		}
+	default:
+		// the framing of unknown messages is unknown as well, the stream can not be resynchronized
+		return nil, fmt.Errorf("%w: type %d", ErrUnknownDeviceMessage, typeBuf[0])
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,69 @@
+package controllers_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kvarenzn/ssm/controllers"
+)
+
+// a control socket capture: clipboard "ssm", ack-clipboard #7, uhid-output for device 2
+var capturedDeviceMessages = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x03, 's', 's', 'm',
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07,
+	0x02, 0x00, 0x02, 0x00, 0x03, 0x01, 0x02, 0x03,
+}
+
+func readAllDeviceMessages(t *testing.T, data []byte) ([]*controllers.DeviceMessage, error) {
+	t.Helper()
+	r := bytes.NewReader(data)
+	result := []*controllers.DeviceMessage{}
+	for {
+		msg, err := controllers.ReadDeviceMessage(r)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, msg)
+	}
+}
+
+func TestDeviceMessages(t *testing.T) {
+	msgs, err := readAllDeviceMessages(t, capturedDeviceMessages)
+	if err != io.EOF {
+		t.Fatalf("Expected io.EOF, but got %v", err)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatalf("Expected 3 messages, but got %d", len(msgs))
+	}
+
+	if msgs[0].Type != controllers.DeviceMessageClipboard || msgs[0].Text != "ssm" {
+		t.Errorf("Unexpected clipboard message: %+v", msgs[0])
+	}
+
+	if msgs[1].Type != controllers.DeviceMessageAckClipboard || msgs[1].Sequence != 7 {
+		t.Errorf("Unexpected ack-clipboard message: %+v", msgs[1])
+	}
+
+	if msgs[2].Type != controllers.DeviceMessageUHIDOutput || msgs[2].UHIDID != 2 || !bytes.Equal(msgs[2].Data, []byte{1, 2, 3}) {
+		t.Errorf("Unexpected uhid-output message: %+v", msgs[2])
+	}
+}
+
+func TestTruncatedDeviceMessage(t *testing.T) {
+	for i := 1; i < 8; i++ {
+		msgs, err := readAllDeviceMessages(t, capturedDeviceMessages[:i])
+		if len(msgs) != 0 || err != io.ErrUnexpectedEOF {
+			t.Errorf("Truncated at %d: expected io.ErrUnexpectedEOF, but got %d message(s) and %v", i, len(msgs), err)
+		}
+	}
+}
+
+func TestUnknownDeviceMessage(t *testing.T) {
+	msgs, err := readAllDeviceMessages(t, append(capturedDeviceMessages[:8:8], 0x7f, 0x00))
+	if len(msgs) != 1 || !errors.Is(err, controllers.ErrUnknownDeviceMessage) {
+		t.Errorf("Expected 1 message and ErrUnknownDeviceMessage, but got %d message(s) and %v", len(msgs), err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/utils"
+)
+
+const DefaultScrcpyVersion = "3.3.1"
+
+// sha256 of the official `scrcpy-server` releases, the protocol of ScrcpyController is verified against them
+var scrcpyServerChecksums = map[string]string{
+	"3.3.1": "a0f70b20aa4998fbf658c94118cd6c8dab6abbb0647a3bdab344d70bc1ebcbb8",
+}
+
+func ScrcpyServerChecksum(version string) (string, bool) {
+	sum, ok := scrcpyServerChecksums[version]
+	return sum, ok
+}
+
+func ScrcpyServerVersions() []string {
+	return utils.SortedKeysOf(scrcpyServerChecksums)
+}
+
+func ScrcpyServerDownloadURL(version string) string {
+	return fmt.Sprintf("https://github.com/Genymobile/scrcpy/releases/download/v%s/scrcpy-server-v%s", version, version)
+}
+
+// WithScrcpyDefaults returns a copy of o with defaults filled, o may be nil
+func WithScrcpyDefaults(o *config.ScrcpyOptions) *config.ScrcpyOptions {
+	result := config.ScrcpyOptions{}
+	if o != nil {
+		result = *o
+	}
+
+	if result.Version == "" {
+		result.Version = DefaultScrcpyVersion
+	}
+
+	if result.ServerPath == "" {
+		result.ServerPath = "scrcpy-server-v" + result.Version
+	}
+
+	if result.LogLevel == "" {
+		result.LogLevel = "info"
+	}
+
+	return &result
+}
+
+func scrcpyServerArgs(o *config.ScrcpyOptions, sessionID string) []string {
+	args := []string{
+		o.Version,
+		fmt.Sprintf("scid=%s", sessionID),
+		fmt.Sprintf("log_level=%s", o.LogLevel),
+		fmt.Sprintf("video=%t", !o.NoVideo),
+		fmt.Sprintf("audio=%t", o.AudioSource != ""),
+		"clipboard_autosync=false", // disable clipboard
+	}
+
+	if !o.NoVideo {
+		if o.MaxSize > 0 {
+			args = append(args, fmt.Sprintf("max_size=%d", o.MaxSize))
+		}
+
+		if o.BitRate > 0 {
+			args = append(args, fmt.Sprintf("video_bit_rate=%d", o.BitRate))
+		}
+
+		if o.Codec != "" {
+			args = append(args, fmt.Sprintf("video_codec=%s", strings.ToLower(o.Codec)))
+		}
+	}
+
+	if o.AudioSource != "" {
+		args = append(args, fmt.Sprintf("audio_source=%s", o.AudioSource))
+
+		if o.AudioCodec != "" {
+			args = append(args, fmt.Sprintf("audio_codec=%s", strings.ToLower(o.AudioCodec)))
+		}
+	}
+
+	if o.DisplayID != 0 {
+		args = append(args, fmt.Sprintf("display_id=%d", o.DisplayID))
+	}
+
+	return args
+}
@@ -0,0 +1,57 @@
+package controllers_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kvarenzn/ssm/controllers"
+)
+
+// testdata/pcm_32x32.dump is what scrcpy-server sends through the video socket after the device name:
+// the h264 codec header, a config packet and two 32x32 key frames
+func remuxDump(t *testing.T, name string) []byte {
+	t.Helper()
+
+	dump, err := os.Open("testdata/pcm_32x32.dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dump.Close()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := controllers.RemuxVideoDump(dump, path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRemuxMatroska(t *testing.T) {
+	data := remuxDump(t, "session.mkv")
+	if !bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		t.Errorf("Expected an EBML header, but got % x", data[:min(len(data), 4)])
+	}
+
+	if !bytes.Contains(data, []byte("V_MPEG4/ISO/AVC")) {
+		t.Error("Expected an H.264 track")
+	}
+}
+
+func TestRemuxMP4(t *testing.T) {
+	data := remuxDump(t, "session.mp4")
+	if len(data) < 8 || !bytes.Equal(data[4:8], []byte("ftyp")) {
+		t.Errorf("Expected an ftyp box, but got % x", data[:min(len(data), 8)])
+	}
+
+	for _, box := range []string{"avcC", "mdat"} {
+		if !bytes.Contains(data, []byte(box)) {
+			t.Errorf("Expected a %s box", box)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package controllers
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/stage"
+)
+
+const (
+	controlMsgUHIDCreate  = 12 // SC_CONTROL_MSG_TYPE_UHID_CREATE
+	controlMsgUHIDInput   = 13 // SC_CONTROL_MSG_TYPE_UHID_INPUT
+	controlMsgUHIDDestroy = 14 // SC_CONTROL_MSG_TYPE_UHID_DESTROY
+)
+
+const (
+	uhidTouchscreenID   = 1
+	uhidTouchscreenName = "ssm touchscreen"
+)
+
+func encodeUHIDCreate(id uint16, name string, reportDescription []byte) []byte {
+	data := []byte{controlMsgUHIDCreate}
+	data = binary.BigEndian.AppendUint16(data, id)
+	data = binary.BigEndian.AppendUint16(data, 0) // vendor id
+	data = binary.BigEndian.AppendUint16(data, 0) // product id
+	data = append(data, byte(len(name)))
+	data = append(data, name...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(reportDescription)))
+	return append(data, reportDescription...)
+}
+
+func encodeUHIDInput(id uint16, report []byte) []byte {
+	data := []byte{controlMsgUHIDInput}
+	data = binary.BigEndian.AppendUint16(data, id)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(report)))
+	return append(data, report...)
+}
+
+func encodeUHIDDestroy(id uint16) []byte {
+	data := []byte{controlMsgUHIDDestroy}
+	return binary.BigEndian.AppendUint16(data, id)
+}
+
+// OpenUHID creates a virtual touchscreen on the device, with the same report descriptor as the `hid` backend.
+// Touches are sent as HID reports through it from now on, instead of INJECT_TOUCH_EVENT messages.
+func (c *ScrcpyController) OpenUHID() error {
+	desc := NewHIDDescriptor(c.dc)
+	desc.Width, desc.Height = c.Size()
+
+	if err := c.Send(encodeUHIDCreate(uhidTouchscreenID, uhidTouchscreenName, desc.Bytes())); err != nil {
+		return err
+	}
+
+	c.uhid = desc
+	c.uhidSince = time.Now()
+	return nil
+}
+
+// stampScanTime sets the scan time of a touch report sent through the virtual touchscreen to the time it is sent
+func (c *ScrcpyController) stampScanTime(data []byte) []byte {
+	const header = 5 // type, id and size
+	if c.uhid == nil || len(data) != header+c.uhid.ReportSize() || data[0] != controlMsgUHIDInput {
+		return data
+	}
+
+	return append(data[:header:header], c.uhid.StampScanTime(data[header:], time.Since(c.uhidSince))...)
+}
+
+func (c *ScrcpyController) closeUHID() error {
+	if c.uhid == nil {
+		return nil
+	}
+
+	// lift every finger, the touchscreen is gone right after
+	err := errors.Join(c.ReleaseAll(), c.Send(encodeUHIDDestroy(uhidTouchscreenID)))
+	c.uhid = nil
+	return err
+}
+
+func (c *ScrcpyController) preprocessUHID(rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error) {
+	result, err := genHIDReports(c.uhid, c.turnRight, rawEvents, calc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range result {
+		result[i].Data = encodeUHIDInput(uhidTouchscreenID, item.Data)
+	}
+	return result, nil
+}
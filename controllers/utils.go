@@ -8,10 +8,6 @@ import (
 	"math"
 )
 
-func interp(a, b, t float64) float64 {
-	return a + (b-a)*t
-}
-
 func roundint(f float64) int {
 	return int(math.Round(f))
 }
@@ -25,7 +21,3 @@ func clamp[T cmp.Ordered](x, lo, hi T) T {
 		return x
 	}
 }
-
-func crinterp(a, b, t, lo, hi float64) int {
-	return clamp(roundint(interp(a, b, t)), int(lo), int(hi))
-}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/kvarenzn/ssm/locale"
+	"github.com/kvarenzn/ssm/utils"
 )
 
 type SongInfo struct {
@@ -91,6 +92,10 @@ func (s *BestdoriSongs) Jacket(id int) (string, string) {
 	return filepath.Join(path, "thumb.png"), filepath.Join(path, "jacket.png")
 }
 
+func (s *BestdoriSongs) IDs() []int {
+	return utils.SortedKeysOf(s.Songs)
+}
+
 func NewBestdoriDB() (MusicDatabase, error) {
 	var preferLocale int
 	switch locale.LanguageString[:2] {
@@ -14,6 +14,7 @@ import (
 type MusicDatabase interface {
 	Title(id int, format string) string
 	Jacket(id int) (string, string)
+	IDs() []int
 }
 
 func httpGetJson(url string) ([]byte, error) {
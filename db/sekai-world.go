@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+
+	"github.com/kvarenzn/ssm/utils"
 )
 
 type sekaiMusicInfo struct {
@@ -64,6 +66,10 @@ func (s *sekaiMusics) Jacket(id int) (string, string) {
 	return thumbnail, jackets[0]
 }
 
+func (s *sekaiMusics) IDs() []int {
+	return utils.SortedKeysOf(s.Map)
+}
+
 func NewSekaiDB() (MusicDatabase, error) {
 	data, err := loadFromFileOrUrlAndSave("./musics.json", "https://sekai-world.github.io/sekai-master-db-diff/musics.json")
 	if err != nil {
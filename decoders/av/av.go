@@ -12,6 +12,7 @@ import "C"
 
 import (
 	"errors"
+	"image"
 	"unsafe"
 )
 
@@ -34,6 +35,7 @@ type AVDecoder struct {
 	codec     *C.AVCodec
 	ctx       *C.AVCodecContext
 	needMerge bool
+	audio     bool
 }
 
 var (
@@ -41,11 +43,14 @@ var (
 	ErrOutOfMemory      = errors.New("out of memory")
 	ErrSendPacketFailed = errors.New("failed to send packet")
 	ErrDecodeFailed     = errors.New("decode error")
+
+	ErrUnsupportedPixelFormat  = errors.New("unsupported pixel format")
+	ErrUnsupportedSampleFormat = errors.New("unsupported sample format")
 )
 
-func NewAVDecoder(id string) (*AVDecoder, error) {
-	var codecId uint32 = C.AV_CODEC_ID_NONE
-	needMerge := false
+// codecIDOf maps the codec id sent by scrcpy-server to the one of libavcodec
+func codecIDOf(id string) (codecId uint32, needMerge bool) {
+	codecId = C.AV_CODEC_ID_NONE
 	switch id {
 	case "h264":
 		codecId = C.AV_CODEC_ID_H264
@@ -64,19 +69,52 @@ func NewAVDecoder(id string) (*AVDecoder, error) {
 	case "raw\x00":
 		codecId = C.AV_CODEC_ID_PCM_S16LE
 	}
+	return
+}
 
+func NewAVDecoder(id string) (*AVDecoder, error) {
+	codecId, needMerge := codecIDOf(id)
 	codec := C.avcodec_find_decoder(codecId)
-	ctx := C.avcodec_alloc_context3(codec)
+	d := &AVDecoder{
+		needMerge: needMerge,
+		codec:     codec,
+		audio:     codec != nil && codec._type == C.AVMEDIA_TYPE_AUDIO,
+	}
 
-	if C.avcodec_open2(ctx, codec, nil) != 0 {
-		return nil, ErrCodecOpenFailed
+	if err := d.open(nil); err != nil {
+		return nil, err
 	}
 
-	return &AVDecoder{
-		needMerge: needMerge,
-		codec:     codec,
-		ctx:       ctx,
-	}, nil
+	return d, nil
+}
+
+// open (re)opens the codec context, extradata is the config packet of audio codecs
+func (d *AVDecoder) open(extradata []byte) error {
+	if d.ctx != nil {
+		C.avcodec_free_context(&d.ctx)
+	}
+
+	d.ctx = C.avcodec_alloc_context3(d.codec)
+	if d.audio {
+		// ref: app/src/demuxer.c @ Genymobile/scrcpy, the audio is always 48 kHz stereo
+		d.ctx.sample_rate = 48000
+		C.av_channel_layout_default(&d.ctx.ch_layout, 2)
+	}
+
+	if len(extradata) > 0 {
+		d.ctx.extradata = (*C.uint8_t)(C.av_mallocz(C.size_t(len(extradata) + C.AV_INPUT_BUFFER_PADDING_SIZE)))
+		if d.ctx.extradata == nil {
+			return ErrOutOfMemory
+		}
+		C.memcpy(unsafe.Pointer(d.ctx.extradata), unsafe.Pointer(&extradata[0]), C.size_t(len(extradata)))
+		d.ctx.extradata_size = C.int(len(extradata))
+	}
+
+	if C.avcodec_open2(d.ctx, d.codec, nil) != 0 {
+		return ErrCodecOpenFailed
+	}
+
+	return nil
 }
 
 func (d *AVDecoder) Drop() {
@@ -85,9 +123,133 @@ func (d *AVDecoder) Drop() {
 	}
 }
 
-func (d *AVDecoder) Decode(pts uint64, data []byte) error {
+// plane returns row y of plane i of the frame
+func plane(frame *C.AVFrame, i, y, width int) []byte {
+	start := unsafe.Add(unsafe.Pointer(frame.data[i]), y*int(frame.linesize[i]))
+	return unsafe.Slice((*byte)(start), width)
+}
+
+// convertFrame copies the frame to a Go image
+func convertFrame(frame *C.AVFrame) (*Frame, error) {
+	width, height := int(frame.width), int(frame.height)
+	rect := image.Rect(0, 0, width, height)
+
+	result := &Frame{
+		PTS:   int64(frame.pts),
+		BT709: frame.colorspace == C.AVCOL_SPC_BT709,
+	}
+
+	var ratio image.YCbCrSubsampleRatio
+	nv := false
+	switch frame.format {
+	case C.AV_PIX_FMT_YUVJ420P:
+		result.FullRange = true
+		fallthrough
+	case C.AV_PIX_FMT_YUV420P:
+		ratio = image.YCbCrSubsampleRatio420
+	case C.AV_PIX_FMT_YUVJ422P:
+		result.FullRange = true
+		fallthrough
+	case C.AV_PIX_FMT_YUV422P:
+		ratio = image.YCbCrSubsampleRatio422
+	case C.AV_PIX_FMT_YUVJ444P:
+		result.FullRange = true
+		fallthrough
+	case C.AV_PIX_FMT_YUV444P:
+		ratio = image.YCbCrSubsampleRatio444
+	case C.AV_PIX_FMT_NV12, C.AV_PIX_FMT_NV21:
+		ratio = image.YCbCrSubsampleRatio420
+		nv = true
+	default:
+		return nil, ErrUnsupportedPixelFormat
+	}
+
+	if frame.color_range == C.AVCOL_RANGE_JPEG {
+		result.FullRange = true
+	}
+
+	img := image.NewYCbCr(rect, ratio)
+	for y := range height {
+		copy(img.Y[y*img.YStride:], plane(frame, 0, y, width))
+	}
+
+	chromaWidth, chromaHeight := img.CStride, len(img.Cb)/img.CStride
+	for y := range chromaHeight {
+		cb, cr := img.Cb[y*img.CStride:], img.Cr[y*img.CStride:]
+		if !nv {
+			copy(cb, plane(frame, 1, y, chromaWidth))
+			copy(cr, plane(frame, 2, y, chromaWidth))
+			continue
+		}
+
+		// interleaved chroma, CbCr for NV12, CrCb for NV21
+		row := plane(frame, 1, y, chromaWidth*2)
+		if frame.format == C.AV_PIX_FMT_NV21 {
+			cb, cr = cr, cb
+		}
+		for x := range chromaWidth {
+			cb[x] = row[2*x]
+			cr[x] = row[2*x+1]
+		}
+	}
+
+	result.Image = img
+	return result, nil
+}
+
+// convertAudioFrame copies the samples of the frame, mixed down to mono
+func convertAudioFrame(frame *C.AVFrame) (*AudioFrame, error) {
+	channels, n := int(frame.ch_layout.nb_channels), int(frame.nb_samples)
+	format := C.enum_AVSampleFormat(frame.format)
+
+	var size int
+	var sample func(p unsafe.Pointer) float32
+	switch C.av_get_packed_sample_fmt(format) {
+	case C.AV_SAMPLE_FMT_FLT:
+		size = 4
+		sample = func(p unsafe.Pointer) float32 { return *(*float32)(p) }
+	case C.AV_SAMPLE_FMT_S16:
+		size = 2
+		sample = func(p unsafe.Pointer) float32 { return float32(*(*int16)(p)) / (1 << 15) }
+	case C.AV_SAMPLE_FMT_S32:
+		size = 4
+		sample = func(p unsafe.Pointer) float32 { return float32(*(*int32)(p)) / (1 << 31) }
+	default:
+		return nil, ErrUnsupportedSampleFormat
+	}
+
+	planar := C.av_sample_fmt_is_planar(format) != 0
+	planes := unsafe.Slice(frame.extended_data, channels)
+	result := &AudioFrame{
+		PTS:        int64(frame.pts),
+		SampleRate: int(frame.sample_rate),
+		Samples:    make([]float32, n),
+	}
+
+	for i := range n {
+		sum := float32(0)
+		for c := range channels {
+			if planar {
+				sum += sample(unsafe.Add(unsafe.Pointer(planes[c]), i*size))
+			} else {
+				sum += sample(unsafe.Add(unsafe.Pointer(planes[0]), (i*channels+c)*size))
+			}
+		}
+		result.Samples[i] = sum / float32(channels)
+	}
+
+	return result, nil
+}
+
+// send sends a packet from scrcpy-server to the decoder.
+// Config packets are merged into the next packet, except for audio codecs, which take them as extradata.
+func (d *AVDecoder) send(pts uint64, data []byte) error {
+	if pts&SC_PACKET_FLAG_CONFIG != 0 && d.audio {
+		return d.open(data)
+	}
+
 	packet := C.av_packet_alloc()
-	frame := C.av_frame_alloc()
+	defer C.av_packet_free(&packet)
 
 	C.av_new_packet(packet, C.int(len(data)))
 	C.memcpy(unsafe.Pointer(packet.data), unsafe.Pointer(&data[0]), C.size_t(len(data)))
@@ -116,28 +278,73 @@ func (d *AVDecoder) Decode(pts uint64, data []byte) error {
 
 	packet.dts = packet.pts
 
-	ret := C.avcodec_send_packet(d.ctx, packet)
-	if ret < 0 {
+	if C.avcodec_send_packet(d.ctx, packet) < 0 {
 		return ErrSendPacketFailed
 	}
 
 	C.av_packet_unref(packet)
+	return nil
+}
+
+// receive passes each frame completed by the decoder to convert
+func (d *AVDecoder) receive(convert func(frame *C.AVFrame) error) error {
+	frame := C.av_frame_alloc()
+	defer C.av_frame_free(&frame)
 
 	for {
-		ret = C.avcodec_receive_frame(d.ctx, frame)
+		ret := C.avcodec_receive_frame(d.ctx, frame)
 		if ret == C.AVERROR_EOF || ret == -C.EAGAIN {
-			break
+			return nil
 		} else if ret < 0 {
 			return ErrDecodeFailed
 		}
 
-		// [TODO] process decoded frame
-
+		err := convert(frame)
 		C.av_frame_unref(frame)
+		if err != nil {
+			return err
+		}
 	}
+}
 
-	C.av_packet_free(&packet)
-	C.av_frame_free(&frame)
+// Decode decodes a packet of the video stream from scrcpy-server, the frames it completes are returned
+func (d *AVDecoder) Decode(pts uint64, data []byte) ([]*Frame, error) {
+	if err := d.send(pts, data); err != nil {
+		return nil, err
+	}
 
-	return nil
+	frames := []*Frame{}
+	err := d.receive(func(frame *C.AVFrame) error {
+		f, err := convertFrame(frame)
+		if err != nil {
+			return err
+		}
+
+		frames = append(frames, f)
+		return nil
+	})
+	return frames, err
+}
+
+// DecodeAudio decodes a packet of the audio stream from scrcpy-server, the frames it completes are returned
+func (d *AVDecoder) DecodeAudio(pts uint64, data []byte) ([]*AudioFrame, error) {
+	if err := d.send(pts, data); err != nil {
+		return nil, err
+	}
+
+	frames := []*AudioFrame{}
+	if pts&SC_PACKET_FLAG_CONFIG != 0 {
+		return frames, nil
+	}
+
+	err := d.receive(func(frame *C.AVFrame) error {
+		f, err := convertAudioFrame(frame)
+		if err != nil {
+			return err
+		}
+
+		frames = append(frames, f)
+		return nil
+	})
+	return frames, err
 }
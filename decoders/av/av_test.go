@@ -0,0 +1,117 @@
+package av_test
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/kvarenzn/ssm/decoders/av"
+)
+
+// splitAnnexB splits an H.264 elementary stream into NAL units, start codes included
+func splitAnnexB(data []byte) [][]byte {
+	startCode := []byte{0, 0, 0, 1}
+	result := [][]byte{}
+	for len(data) > 0 {
+		next := bytes.Index(data[len(startCode):], startCode)
+		if next < 0 {
+			result = append(result, data)
+			break
+		}
+
+		result = append(result, data[:next+len(startCode)])
+		data = data[next+len(startCode):]
+	}
+	return result
+}
+
+// testdata/pcm_32x32.h264 holds two 32x32 IDR frames made of I_PCM macroblocks, so the decoded samples are exact:
+// Y = 16 + 3x + 2y + i, Cb = 64 + 2x + y + i, Cr = 192 - x - 2y + i, for frame i
+func TestDecodePCMClip(t *testing.T) {
+	data, err := os.ReadFile("testdata/pcm_32x32.h264")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nals := splitAnnexB(data)
+	if len(nals) != 4 {
+		t.Fatalf("Expected 4 NAL units, but got %d", len(nals))
+	}
+
+	d, err := av.NewAVDecoder("h264")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Drop()
+
+	// the same packets scrcpy-server would send: SPS and PPS as a config packet, then a key frame per slice
+	config := append(append([]byte{}, nals[0]...), nals[1]...)
+	if _, err := d.Decode(av.SC_PACKET_FLAG_CONFIG, config); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []*av.Frame{}
+	for i, nal := range nals[2:] {
+		result, err := d.Decode(av.SC_PACKET_FLAG_KEY_FRAME|uint64(i*16666), nal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, result...)
+	}
+
+	if len(frames) == 0 {
+		t.Fatal("No frame decoded")
+	}
+
+	for i, frame := range frames {
+		img := frame.Image
+		if img.Bounds() != image.Rect(0, 0, 32, 32) {
+			t.Fatalf("Unexpected frame size: %v", img.Bounds())
+		}
+
+		if frame.PTS != int64(i*16666) {
+			t.Errorf("Expected pts %d, but got %d", i*16666, frame.PTS)
+		}
+
+		for y := range 32 {
+			for x := range 32 {
+				if got, expected := img.Y[img.YOffset(x, y)], byte(16+3*x+2*y+i); got != expected {
+					t.Fatalf("Frame %d: expected Y %d at (%d, %d), but got %d", i, expected, x, y, got)
+				}
+
+				c := img.COffset(x, y)
+				if got, expected := img.Cb[c], byte(64+2*(x/2)+y/2+i); got != expected {
+					t.Fatalf("Frame %d: expected Cb %d at (%d, %d), but got %d", i, expected, x, y, got)
+				}
+				if got, expected := img.Cr[c], byte(192-x/2-2*(y/2)+i); got != expected {
+					t.Fatalf("Frame %d: expected Cr %d at (%d, %d), but got %d", i, expected, x, y, got)
+				}
+			}
+		}
+	}
+}
+
+func TestFrameRGBA(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 4, 1), image.YCbCrSubsampleRatio444)
+	copy(img.Y, []byte{16, 235, 128, 81})
+	copy(img.Cb, []byte{128, 128, 128, 90})
+	copy(img.Cr, []byte{128, 128, 128, 240})
+
+	limited := (&av.Frame{Image: img}).RGBA(nil)
+	for i, expected := range [][4]byte{{0, 0, 0, 255}, {255, 255, 255, 255}, {130, 130, 130, 255}, {254, 0, 0, 255}} {
+		if got := [4]byte(limited.Pix[i*4 : i*4+4]); got != expected {
+			t.Errorf("Limited range pixel %d: expected %v, but got %v", i, expected, got)
+		}
+	}
+
+	dst := limited
+	full := (&av.Frame{Image: img, FullRange: true}).RGBA(dst)
+	if full != dst {
+		t.Error("Expected the buffer to be reused")
+	}
+
+	if got := [4]byte(full.Pix[8:12]); got != [4]byte{128, 128, 128, 255} {
+		t.Errorf("Full range pixel 2: expected gray 128, but got %v", got)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package av
+
+import (
+	"image"
+	"time"
+)
+
+// Frame is a decoded video frame
+type Frame struct {
+	PTS       int64     // microseconds, as sent by scrcpy-server
+	Received  time.Time // when the packet of the frame was read, zero if unknown
+	Image     *image.YCbCr
+	FullRange bool // YUVJ formats use 0 ~ 255, the others 16 ~ 235
+	BT709     bool // BT.709 colorspace, BT.601 otherwise
+}
+
+// AudioFrame is a decoded audio frame, mixed down to mono
+type AudioFrame struct {
+	PTS        int64     // microseconds, as sent by scrcpy-server
+	Received   time.Time // when the packet of the frame was read, zero if unknown
+	SampleRate int
+	Samples    []float32 // -1 ~ 1
+}
+
+func clamp8(v int32) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// coefficients in 16.16 fixed point: Y scale, Cr -> R, Cb -> G, Cr -> G, Cb -> B
+type yuvCoefficients [5]int32
+
+var (
+	bt601Limited = yuvCoefficients{76309, 104597, 25675, 53279, 132201}
+	bt601Full    = yuvCoefficients{65536, 91881, 22554, 46802, 116130}
+	bt709Limited = yuvCoefficients{76309, 117489, 13975, 34925, 138438}
+	bt709Full    = yuvCoefficients{65536, 103206, 12276, 30679, 121609}
+)
+
+func (f *Frame) coefficients() (yuvCoefficients, int32) {
+	switch {
+	case f.BT709 && f.FullRange:
+		return bt709Full, 0
+	case f.BT709:
+		return bt709Limited, 16
+	case f.FullRange:
+		return bt601Full, 0
+	default:
+		return bt601Limited, 16
+	}
+}
+
+// RGBA converts the frame to RGBA, dst is reused if it has the same bounds
+func (f *Frame) RGBA(dst *image.RGBA) *image.RGBA {
+	src := f.Image
+	bounds := src.Bounds()
+	if dst == nil || dst.Bounds() != bounds {
+		dst = image.NewRGBA(bounds)
+	}
+
+	k, yOffset := f.coefficients()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := dst.Pix[(y-bounds.Min.Y)*dst.Stride:]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			yy := (int32(src.Y[src.YOffset(x, y)]) - yOffset) * k[0]
+			ci := src.COffset(x, y)
+			cb := int32(src.Cb[ci]) - 128
+			cr := int32(src.Cr[ci]) - 128
+
+			p := row[(x-bounds.Min.X)*4:]
+			p[0] = clamp8((yy + k[1]*cr + 1<<15) >> 16)
+			p[1] = clamp8((yy - k[2]*cb - k[3]*cr + 1<<15) >> 16)
+			p[2] = clamp8((yy + k[4]*cb + 1<<15) >> 16)
+			p[3] = 0xff
+		}
+	}
+
+	return dst
+}
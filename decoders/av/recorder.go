@@ -0,0 +1,149 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package av
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include <libavformat/avformat.h>
+// #include <libavcodec/avcodec.h>
+// #include <libavutil/mem.h>
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var (
+	ErrUnsupportedContainer = errors.New("unsupported container format")
+	ErrUnsupportedCodec     = errors.New("unsupported codec")
+	ErrRecorderIO           = errors.New("failed to write recording")
+)
+
+// Recorder remuxes the packets from scrcpy-server into a container without re-encoding,
+// the format (Matroska, MP4, ...) is guessed from the file extension.
+//
+// ref: app/src/recorder.c @ Genymobile/scrcpy
+type Recorder struct {
+	ctx           *C.AVFormatContext
+	stream        *C.AVStream
+	pending       []byte // config packet to be merged into the next packet
+	headerWritten bool
+}
+
+func NewRecorder(path string, codec string, width, height int) (*Recorder, error) {
+	codecId, _ := codecIDOf(codec)
+	if codecId == C.AV_CODEC_ID_NONE {
+		return nil, ErrUnsupportedCodec
+	}
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	var ctx *C.AVFormatContext
+	if C.avformat_alloc_output_context2(&ctx, nil, nil, cpath) < 0 {
+		return nil, ErrUnsupportedContainer
+	}
+
+	stream := C.avformat_new_stream(ctx, nil)
+	if stream == nil {
+		C.avformat_free_context(ctx)
+		return nil, ErrOutOfMemory
+	}
+
+	stream.codecpar.codec_type = C.AVMEDIA_TYPE_VIDEO
+	stream.codecpar.codec_id = codecId
+	stream.codecpar.width = C.int(width)
+	stream.codecpar.height = C.int(height)
+	stream.time_base = C.AVRational{num: 1, den: 1000000}
+
+	if C.avio_open(&ctx.pb, cpath, C.AVIO_FLAG_WRITE) < 0 {
+		C.avformat_free_context(ctx)
+		return nil, ErrRecorderIO
+	}
+
+	return &Recorder{
+		ctx:    ctx,
+		stream: stream,
+	}, nil
+}
+
+func (r *Recorder) setExtradata(data []byte) error {
+	// the config packet may come again before the header is written
+	C.av_freep(unsafe.Pointer(&r.stream.codecpar.extradata))
+	r.stream.codecpar.extradata_size = 0
+
+	extradata := (*C.uint8_t)(C.av_mallocz(C.size_t(len(data) + C.AV_INPUT_BUFFER_PADDING_SIZE)))
+	if extradata == nil {
+		return ErrOutOfMemory
+	}
+
+	C.memcpy(unsafe.Pointer(extradata), unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	r.stream.codecpar.extradata = extradata
+	r.stream.codecpar.extradata_size = C.int(len(data))
+	return nil
+}
+
+// Write writes a packet, with the pts and flags in the same form as Decode takes
+func (r *Recorder) Write(pts uint64, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if pts&SC_PACKET_FLAG_CONFIG != 0 {
+		if !r.headerWritten {
+			return r.setExtradata(data)
+		}
+
+		// the stream is reconfigured (e.g. the screen is rotated), keep the new parameter sets in band
+		r.pending = append([]byte{}, data...)
+		return nil
+	}
+
+	if !r.headerWritten {
+		if C.avformat_write_header(r.ctx, nil) < 0 {
+			return ErrRecorderIO
+		}
+		r.headerWritten = true
+	}
+
+	if r.pending != nil {
+		data = append(r.pending, data...)
+		r.pending = nil
+	}
+
+	packet := C.av_packet_alloc()
+	defer C.av_packet_free(&packet)
+
+	if C.av_new_packet(packet, C.int(len(data))) < 0 {
+		return ErrOutOfMemory
+	}
+	C.memcpy(unsafe.Pointer(packet.data), unsafe.Pointer(&data[0]), C.size_t(len(data)))
+
+	packet.stream_index = r.stream.index
+	packet.pts = C.av_rescale_q(C.int64_t(pts&SC_PACKET_PTS_MASK), C.AVRational{num: 1, den: 1000000}, r.stream.time_base)
+	packet.dts = packet.pts
+	if pts&SC_PACKET_FLAG_KEY_FRAME != 0 {
+		packet.flags |= C.AV_PKT_FLAG_KEY
+	}
+
+	if C.av_write_frame(r.ctx, packet) < 0 {
+		return ErrRecorderIO
+	}
+
+	return nil
+}
+
+// Close finishes the file, a recording without any frame is left empty
+func (r *Recorder) Close() error {
+	var err error
+	if r.headerWritten && C.av_write_trailer(r.ctx) < 0 {
+		err = ErrRecorderIO
+	}
+
+	C.avio_closep(&r.ctx.pb)
+	C.avformat_free_context(r.ctx)
+	r.ctx = nil
+	return err
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package drift estimates how fast the clock of the game runs compared with the local one,
+// from the moments notes are seen or heard on the device.
+package drift
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	MinHits = 8                // hits needed for an estimate
+	MinSpan = 20 * time.Second // of local time the hits have to cover
+
+	// the clocks never differ this much, an estimate beyond is a mistake
+	MaxScaleError = 0.01
+
+	// hits further than this many residuals from the line are mistaken, e.g. matched with a wrong note
+	outlierFactor = 3
+	minTolerance  = 10 * time.Millisecond
+	maxHits       = 1024
+)
+
+// Estimate is the line chart = Scale*local + Offset
+type Estimate struct {
+	Scale    float64
+	Offset   time.Duration
+	Residual time.Duration // root mean square, of the hits kept
+	Hits     int           // number of hits kept
+}
+
+// At returns the chart time at local
+func (e Estimate) At(local time.Duration) time.Duration {
+	return time.Duration(math.Round(e.Scale*float64(local))) + e.Offset
+}
+
+type hit struct {
+	local, chart float64 // in milliseconds
+}
+
+// Estimator fits the hits with a line by least squares
+type Estimator struct {
+	hits []hit
+}
+
+func NewEstimator() *Estimator {
+	return &Estimator{}
+}
+
+// Observe adds a hit: the note at chart time was seen or heard at local time.
+// Only the latest hits are kept.
+func (e *Estimator) Observe(local, chart time.Duration) {
+	if len(e.hits) == maxHits {
+		e.hits = append(e.hits[:0], e.hits[1:]...)
+	}
+
+	e.hits = append(e.hits, hit{
+		local: float64(local) / float64(time.Millisecond),
+		chart: float64(chart) / float64(time.Millisecond),
+	})
+}
+
+// Len is the number of hits observed
+func (e *Estimator) Len() int {
+	return len(e.hits)
+}
+
+func fit(hits []hit) (scale, offset, residual float64, ok bool) {
+	n := float64(len(hits))
+	if n < 2 {
+		return 0, 0, 0, false
+	}
+
+	meanX, meanY := 0.0, 0.0
+	for _, h := range hits {
+		meanX += h.local
+		meanY += h.chart
+	}
+	meanX /= n
+	meanY /= n
+
+	sxx, sxy := 0.0, 0.0
+	for _, h := range hits {
+		dx := h.local - meanX
+		sxx += dx * dx
+		sxy += dx * (h.chart - meanY)
+	}
+	if sxx == 0 {
+		return 0, 0, 0, false
+	}
+
+	scale = sxy / sxx
+	offset = meanY - scale*meanX
+
+	sum := 0.0
+	for _, h := range hits {
+		d := h.chart - (scale*h.local + offset)
+		sum += d * d
+	}
+
+	return scale, offset, math.Sqrt(sum / n), true
+}
+
+// Estimate fits the hits, then fits again without the outliers.
+// It does not if the hits are too few or too close, or the result is implausible.
+func (e *Estimator) Estimate() (Estimate, bool) {
+	if len(e.hits) < MinHits {
+		return Estimate{}, false
+	}
+
+	scale, offset, residual, ok := fit(e.hits)
+	if !ok {
+		return Estimate{}, false
+	}
+
+	tolerance := max(outlierFactor*residual, float64(minTolerance)/float64(time.Millisecond))
+	kept := make([]hit, 0, len(e.hits))
+	for _, h := range e.hits {
+		if math.Abs(h.chart-(scale*h.local+offset)) <= tolerance {
+			kept = append(kept, h)
+		}
+	}
+
+	if len(kept) < MinHits {
+		return Estimate{}, false
+	}
+
+	first, last := kept[0].local, kept[0].local
+	for _, h := range kept {
+		first = min(first, h.local)
+		last = max(last, h.local)
+	}
+	if time.Duration((last-first)*float64(time.Millisecond)) < MinSpan {
+		return Estimate{}, false
+	}
+
+	if scale, offset, residual, ok = fit(kept); !ok || math.Abs(scale-1) > MaxScaleError {
+		return Estimate{}, false
+	}
+
+	return Estimate{
+		Scale:    scale,
+		Offset:   time.Duration(offset * float64(time.Millisecond)),
+		Residual: time.Duration(residual * float64(time.Millisecond)),
+		Hits:     len(kept),
+	}, true
+}
@@ -0,0 +1,93 @@
+package drift_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/kvarenzn/ssm/drift"
+)
+
+// observe adds a hit every 500ms for the given duration, on the line chart = scale*local + offset with jitter
+func observe(e *drift.Estimator, rng *rand.Rand, duration time.Duration, scale float64, offset, jitter time.Duration) {
+	for local := time.Duration(0); local < duration; local += 500 * time.Millisecond {
+		noise := time.Duration((rng.Float64()*2 - 1) * float64(jitter))
+		e.Observe(local, time.Duration(scale*float64(local))+offset+noise)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	rng := rand.New(rand.NewSource(47))
+	e := drift.NewEstimator()
+	observe(e, rng, 2*time.Minute, 1.0005, 2*time.Second, 8*time.Millisecond)
+
+	estimate, ok := e.Estimate()
+	if !ok {
+		t.Fatal("No estimate from 2 minutes of hits")
+	}
+
+	if math.Abs(estimate.Scale-1.0005) > 5e-5 {
+		t.Errorf("Scale: got %.6f, want 1.0005", estimate.Scale)
+	}
+	if d := estimate.Offset - 2*time.Second; d < -5*time.Millisecond || d > 5*time.Millisecond {
+		t.Errorf("Offset: got %v, want 2s", estimate.Offset)
+	}
+	if estimate.Residual > 8*time.Millisecond {
+		t.Errorf("Residual: got %v, want at most the jitter", estimate.Residual)
+	}
+}
+
+func TestEstimateOutliers(t *testing.T) {
+	rng := rand.New(rand.NewSource(47))
+	e := drift.NewEstimator()
+	observe(e, rng, time.Minute, 0.9996, 0, 5*time.Millisecond)
+
+	// hits matched with the wrong notes
+	for _, local := range []time.Duration{10 * time.Second, 25 * time.Second, 40 * time.Second} {
+		e.Observe(local, local+250*time.Millisecond)
+	}
+
+	estimate, ok := e.Estimate()
+	if !ok {
+		t.Fatal("No estimate")
+	}
+
+	if math.Abs(estimate.Scale-0.9996) > 5e-5 {
+		t.Errorf("Scale: got %.6f, want 0.9996", estimate.Scale)
+	}
+	if estimate.Hits != e.Len()-3 {
+		t.Errorf("Kept %d hits of %d, want the 3 outliers removed", estimate.Hits, e.Len())
+	}
+}
+
+func TestEstimateNotEnough(t *testing.T) {
+	rng := rand.New(rand.NewSource(47))
+
+	few := drift.NewEstimator()
+	for i := range drift.MinHits - 1 {
+		few.Observe(time.Duration(i)*10*time.Second, time.Duration(i)*10*time.Second)
+	}
+	if _, ok := few.Estimate(); ok {
+		t.Error("Estimated with too few hits")
+	}
+
+	short := drift.NewEstimator()
+	observe(short, rng, 10*time.Second, 1, 0, 5*time.Millisecond)
+	if _, ok := short.Estimate(); ok {
+		t.Error("Estimated with hits of 10 seconds")
+	}
+
+	implausible := drift.NewEstimator()
+	observe(implausible, rng, time.Minute, 1.05, 0, 5*time.Millisecond)
+	if _, ok := implausible.Estimate(); ok {
+		t.Error("Estimated a scale of 1.05")
+	}
+}
+
+func TestAt(t *testing.T) {
+	estimate := drift.Estimate{Scale: 1.001, Offset: time.Second}
+	if got := estimate.At(10 * time.Second); got != 11010*time.Millisecond {
+		t.Errorf("At(10s): got %v, want 11.01s", got)
+	}
+}
@@ -15,14 +15,25 @@ Copyright (C) 2024, 2025 kvarenzn
 这是自由软件：您可以自由修改和重新发布它。
 在法律允许的范围内，没有任何担保。`)
 	message.SetString(language.SimplifiedChinese, "Usage of %s:", "ssm 的用法：")
-	message.SetString(language.SimplifiedChinese, "usage.b", "指定 ssm 后端，可选值：`hid`，`adb`")
-	message.SetString(language.SimplifiedChinese, "usage.n", "歌曲 ID")
-	message.SetString(language.SimplifiedChinese, "usage.d", "歌曲难度")
+	message.SetString(language.SimplifiedChinese, "usage.b", "指定 ssm 后端，可选值：`hid`，`adb`，`record-hid`，`record-adb`")
+	message.SetString(language.SimplifiedChinese, "usage.n", "歌曲 ID（使用`adb`后端时可省略，从选歌界面识别）")
+	message.SetString(language.SimplifiedChinese, "usage.d", "歌曲难度（使用`adb`后端时可省略，从选歌界面识别）")
 	message.SetString(language.SimplifiedChinese, "usage.e", "从资源路径中解包资源")
-	message.SetString(language.SimplifiedChinese, "usage.r", "设备方向，可选值：`left` （↺, 逆时针），`right`（↻, 顺时针）。注：当使用`adb`后端时本选项被忽略")
-	message.SetString(language.SimplifiedChinese, "usage.p", "指定谱面路径（如果本选项被提供，歌曲 ID 和歌曲难度都会被忽略）")
+	message.SetString(language.SimplifiedChinese, "usage.r", "设备方向，可选值：`left` （↺, 逆时针），`right`（↻, 顺时针）。注：使用`adb`后端时，仅在屏幕画面为竖屏或开启UHID模式时生效")
+	message.SetString(language.SimplifiedChinese, "usage.p", "指定谱面或触摸事件文件路径（如果本选项被提供，歌曲 ID 和歌曲难度都会被忽略）")
+	message.SetString(language.SimplifiedChinese, "usage.o", "将生成的触摸事件保存到指定文件并退出（扩展名为`.vte`时使用二进制格式，否则使用JSON格式）")
 	message.SetString(language.SimplifiedChinese, "usage.s", "指定设备序列号（如果未提供，ssm 会使用第一个检索到的设备序列号）")
 	message.SetString(language.SimplifiedChinese, "usage.k", "切换到PJSK模式")
+	message.SetString(language.SimplifiedChinese, "usage.l", "指定舞台布局名称（默认根据是否为PJSK模式选择`bang`或`pjsk`），可在`layouts.json`中添加自定义布局")
+	message.SetString(language.SimplifiedChinese, "usage.c", "校准模式：依次点击参考点，用方向键调整位置，拟合判定线并保存到设备配置中")
+	message.SetString(language.SimplifiedChinese, "usage.w", "`record-hid`和`record-adb`后端写入记录的文件路径")
+	message.SetString(language.SimplifiedChinese, "usage.u", "使用`adb`后端时，通过scrcpy创建虚拟UHID触摸屏来发送触摸事件（需要scrcpy 3.x）")
+	message.SetString(language.SimplifiedChinese, "usage.m", "使用`adb`后端时，限制视频流长边的最大像素数（0表示使用配置文件中的值）")
+	message.SetString(language.SimplifiedChinese, "usage.a", "使用`adb`后端时，scrcpy的音频来源，如`output`、`playback`（留空表示使用配置文件中的值，默认关闭音频）")
+	message.SetString(language.SimplifiedChinese, "usage.x", "与`-a`一起使用，从谱面的0时刻开始的歌曲音频（WAV）`文件`，用来在设备音频中找到歌曲开始的时间（留空表示与谱面的音符对齐）")
+	message.SetString(language.SimplifiedChinese, "usage.f", "使用`adb`后端时，将屏幕画面录制到该文件（按扩展名选择格式，如`.mkv`、`.mp4`，不重新编码）")
+	message.SetString(language.SimplifiedChinese, "usage.t", "使用`adb`后端时，无人值守地连续演奏该`轮数`：自动点过结算界面并重新开始，需要在screens.json中测量各界面")
+	message.SetString(language.SimplifiedChinese, "usage.i", "与`-t`一起使用，每轮演奏列表中的下一首歌，而不是同一首")
 	message.SetString(language.SimplifiedChinese, "usage.g", "显示调试信息")
 	message.SetString(language.SimplifiedChinese, "usage.v", "显示 ssm 的版本信息并退出")
 	message.SetString(language.SimplifiedChinese, "ssm version: %s", "ssm 版本：%s")
@@ -51,6 +62,8 @@ Copyright (C) 2024, 2025 kvarenzn
 	message.SetString(language.SimplifiedChinese, "Failed to get key from stdin: %s", "从标准输入读取按键失败：%s")
 	message.SetString(language.SimplifiedChinese, "ui line 1", "\x1b[7m\x1b[1m ← \x1b[0m -10ms   \x1b[7m\x1b[1m Shift-← \x1b[0m -50ms   \x1b[7m\x1b[1m Ctrl-← \x1b[0m -100ms   \x1b[7m\x1b[1m Ctrl-C \x1b[0m 停止")
 	message.SetString(language.SimplifiedChinese, "ui line 2", "\x1b[7m\x1b[1m → \x1b[0m +10ms   \x1b[7m\x1b[1m Shift-→ \x1b[0m +50ms   \x1b[7m\x1b[1m Ctrl-→ \x1b[0m +100ms                ")
+	message.SetString(language.SimplifiedChinese, "ui line 3", "\x1b[7m\x1b[1m ↑ \x1b[0m 加速0.01%%   \x1b[7m\x1b[1m Shift-↑ \x1b[0m 加速0.1%%   \x1b[7m\x1b[1m ↓ \x1b[0m 减速0.01%%   \x1b[7m\x1b[1m Shift-↓ \x1b[0m 减速0.1%%")
+	message.SetString(language.SimplifiedChinese, "ui line 4", "\x1b[7m\x1b[1m 空格 \x1b[0m 暂停/继续   \x1b[7m\x1b[1m [ \x1b[0m 上一小节   \x1b[7m\x1b[1m ] \x1b[0m 下一小节   \x1b[7m\x1b[1m Esc \x1b[0m 停止")
 	message.SetString(language.SimplifiedChinese, "ADB devices:", "ADB设备：")
 	message.SetString(language.SimplifiedChinese, "No authorized devices.", "没有授权的设备。")
 	message.SetString(language.SimplifiedChinese, "No device has serial `%s`", "没有设备拥有序列号 `%s`")
@@ -63,8 +76,76 @@ Copyright (C) 2024, 2025 kvarenzn
 	message.SetString(language.SimplifiedChinese, "Musicscore not found", "未找到谱面")
 	message.SetString(language.SimplifiedChinese, "Musicscore loaded:", "已加载谱面：")
 	message.SetString(language.SimplifiedChinese, "Failed to load musicscore:", "加载谱面失败：")
+	message.SetString(language.SimplifiedChinese, "Failed to load touch event file:", "加载触摸事件文件失败：")
+	message.SetString(language.SimplifiedChinese, "Touch event file loaded, %d event group(s)", "已加载触摸事件文件，共%d组事件")
+	message.SetString(language.SimplifiedChinese, "Failed to save touch event file:", "保存触摸事件文件失败：")
+	message.SetString(language.SimplifiedChinese, "Touch events saved to", "触摸事件已保存到")
 	message.SetString(language.SimplifiedChinese, "Unknown backend: %q", "未知后端：%q")
+	message.SetString(language.SimplifiedChinese, "Unknown stage layout: %q, available: %s", "未知舞台布局：%q，可选：%s")
+	message.SetString(language.SimplifiedChinese, "Failed to load stage layouts:", "加载舞台布局失败：")
+	message.SetString(language.SimplifiedChinese, "Stage layouts loaded:", "已加载舞台布局：")
+	message.SetString(language.SimplifiedChinese, "Failed to load screen specs:", "加载界面配置失败：")
+	message.SetString(language.SimplifiedChinese, "Screen specs loaded:", "已加载界面配置：")
+	message.SetString(language.SimplifiedChinese, "Calibration failed:", "校准失败：")
+	message.SetString(language.SimplifiedChinese, "Calibrating stage layout `%s` (%d/%d)", "正在校准舞台布局`%s` (%d/%d)")
+	message.SetString(language.SimplifiedChinese, "calibration hint: lane %d", "ssm 会在第 %d 条轨道与判定线的交点处点击。请调整位置，直到点击落在轨道中心、判定线上。")
+	message.SetString(language.SimplifiedChinese, "Position: (%.0f, %.0f)", "位置：(%.0f, %.0f)")
+	message.SetString(language.SimplifiedChinese, "calibration keys", "\x1b[7m\x1b[1m ←↑↓→ \x1b[0m 1px   \x1b[7m\x1b[1m Shift \x1b[0m 10px   \x1b[7m\x1b[1m Ctrl \x1b[0m 50px   \x1b[7m\x1b[1m 回车/空格 \x1b[0m 确认   \x1b[7m\x1b[1m Esc \x1b[0m 放弃")
+	message.SetString(language.SimplifiedChinese, "Calibration saved: left %.1f, right %.1f, judge line %.1f", "校准结果已保存：左 %.1f，右 %.1f，判定线 %.1f")
 	message.SetString(language.SimplifiedChinese, "%d pointers used.", "使用了%d个触点。")
+	message.SetString(language.SimplifiedChinese, "Failed to preprocess touch events:", "预处理触摸事件失败：")
+	message.SetString(language.SimplifiedChinese, "Device disconnected, autoplay stopped:", "设备已断开，自动演奏已停止：")
+	message.SetString(language.SimplifiedChinese, "Autoplay stopped:", "自动演奏已停止：")
+	message.SetString(language.SimplifiedChinese, "Send timed out, retrying:", "发送超时，正在重试：")
+	message.SetString(language.SimplifiedChinese, "Failed to start `scrcpy-server`:", "启动`scrcpy-server`失败：")
+	message.SetString(language.SimplifiedChinese, "Failed to query screen size:", "查询屏幕尺寸失败：")
+	message.SetString(language.SimplifiedChinese, "Screen size of device [%s]: %dx%d", "设备[%s]的屏幕尺寸：%dx%d")
+	message.SetString(language.SimplifiedChinese, "Screen size of device [%s] is %dx%d, but %dx%d is saved in config, touches may be misplaced", "设备[%s]的屏幕尺寸为%dx%d，但配置中保存的是%dx%d，触点位置可能不准确")
+	message.SetString(language.SimplifiedChinese, "Display of device [%s]: %dx%d, density %d, rotation %d", "设备[%s]的显示屏：%dx%d，密度%d，旋转%d")
+	message.SetString(language.SimplifiedChinese, "Screen geometry changed: %dx%d -> %dx%d", "屏幕尺寸已改变：%dx%d -> %dx%d")
+	message.SetString(language.SimplifiedChinese, "Failed to read device message:", "读取设备消息失败：")
+	message.SetString(language.SimplifiedChinese, "Device message dropped:", "已丢弃设备消息：")
+	message.SetString(language.SimplifiedChinese, "Failed to destroy UHID touchscreen:", "销毁UHID触摸屏失败：")
+	message.SetString(language.SimplifiedChinese, "Recording screen to", "正在录制屏幕到")
+	message.SetString(language.SimplifiedChinese, "Failed to take screenshot:", "截图失败：")
+	message.SetString(language.SimplifiedChinese, "Screenshot saved to", "截图已保存到")
+	message.SetString(language.SimplifiedChinese, "Failed to load jacket index:", "加载曲绘索引失败：")
+	message.SetString(language.SimplifiedChinese, "Failed to save jacket index:", "保存曲绘索引失败：")
+	message.SetString(language.SimplifiedChinese, "%d jackets indexed.", "已为%d张曲绘建立索引。")
+	message.SetString(language.SimplifiedChinese, "Failed to load jacket of song %d: %s", "加载歌曲%d的曲绘失败：%s")
+	message.SetString(language.SimplifiedChinese, "Unknown screen spec: %q", "未知界面配置：%q")
+	message.SetString(language.SimplifiedChinese, "Jacket matched: song %d, distance %d", "曲绘匹配：歌曲%d，距离%d")
+	message.SetString(language.SimplifiedChinese, "Recognized song %d %s (%s)", "识别到歌曲%d %s（%s）")
+	message.SetString(language.SimplifiedChinese, "Song recognition is experimental, the built-in jacket and badge regions are unmeasured. Check the recognized song before playing", "识别歌曲是实验性功能，内置的曲绘和难度标签位置未经测量，开始演奏前请确认识别结果")
+	message.SetString(language.SimplifiedChinese, "Failed to recognize the selected song:", "识别所选歌曲失败：")
+	message.SetString(language.SimplifiedChinese, "Waiting for the first note in the video...", "正在等待画面中出现第一个音符……")
+	message.SetString(language.SimplifiedChinese, "Offset: %d ms, synced with the video (latency %d ms)", "偏移：%d 毫秒，已与画面同步（延迟 %d 毫秒）")
+	message.SetString(language.SimplifiedChinese, "The first note is not timed, waiting for manual start.", "未能测得第一个音符的时间，请手动开始。")
+	message.SetString(language.SimplifiedChinese, "First note timed at %v (frame %v), latency %v", "第一个音符到达判定线的时间：%v（帧 %v），延迟 %v")
+	message.SetString(language.SimplifiedChinese, "Failed to start repeat play:", "无法开始连续演奏：")
+	message.SetString(language.SimplifiedChinese, "Round %d of %d", "第%d轮，共%d轮")
+	message.SetString(language.SimplifiedChinese, "Screen: %s", "当前界面：%s")
+	message.SetString(language.SimplifiedChinese, "Failed to load jacket:", "加载曲绘失败：")
+	message.SetString(language.SimplifiedChinese, "Unsupported `scrcpy-server` version: %s, supported: %s", "不支持的`scrcpy-server`版本：%s，支持的版本：%s")
+	message.SetString(language.SimplifiedChinese, "Audio is not available on the device.", "设备上的音频不可用。")
+	message.SetString(language.SimplifiedChinese, "Failed to decode video packet:", "解码视频数据包失败：")
+	message.SetString(language.SimplifiedChinese, "Failed to decode audio:", "无法解码音频：")
+	message.SetString(language.SimplifiedChinese, "Failed to decode audio packet:", "解码音频数据包失败：")
+	message.SetString(language.SimplifiedChinese, "Audio frame dropped.", "已丢弃音频帧。")
+	message.SetString(language.SimplifiedChinese, "Waiting for the song in the audio...", "正在等待音频中的歌曲开始……")
+	message.SetString(language.SimplifiedChinese, "Offset: %d ms, synced with the audio", "偏移：%d 毫秒，已与音频同步")
+	message.SetString(language.SimplifiedChinese, "Failed to load the song audio:", "加载歌曲音频失败：")
+	message.SetString(language.SimplifiedChinese, "Audio aligned: chart starts at %v, score %.2f, margin %.2f", "音频已对齐：谱面开始于 %v，相关度 %.2f，领先 %.2f")
+	message.SetString(language.SimplifiedChinese, "Speed: %+.3f%%", "速度：%+.3f%%")
+	message.SetString(language.SimplifiedChinese, "Speed: %+.3f%%, estimated from %d hits", "速度：%+.3f%%，根据%d个音符估计")
+	message.SetString(language.SimplifiedChinese, "Speed estimated: %+.3f%% from %d hits (residual %v)", "估计速度：%+.3f%%，来自%d个音符（残差 %v）")
+	message.SetString(language.SimplifiedChinese, "Lateness: p50 %s, p99 %s, max %s", "发送延迟：p50 %s，p99 %s，最大 %s")
+	message.SetString(language.SimplifiedChinese, "Lateness of %d events: p50 %s, p99 %s, max %s", "%d个事件的发送延迟：p50 %s，p99 %s，最大 %s")
+	message.SetString(language.SimplifiedChinese, "Round %d: lateness of %d events: p50 %s, p99 %s, max %s", "第%d轮：%d个事件的发送延迟：p50 %s，p99 %s，最大 %s")
+	message.SetString(language.SimplifiedChinese, "Paused at %s, press SPACE to resume", "已暂停于 %s，按空格继续")
+	message.SetString(language.SimplifiedChinese, "Failed to seek:", "跳转失败：")
+	message.SetString(language.SimplifiedChinese, "Failed to release the pointers:", "抬起所有手指失败：")
+	message.SetString(language.SimplifiedChinese, "Screen size of device [%s] is %dx%d, but %dx%d is saved in config, the former is used", "设备[%s]的屏幕尺寸为%dx%d，但配置中保存的是%dx%d，将使用前者")
 	message.SetString(language.SimplifiedChinese, "[FATAL]", "\033[1;41m 错误 \033[0m")
 	message.SetString(language.SimplifiedChinese, "[WARN]", "\033[1;45m 警告 \033[0m")
 	message.SetString(language.SimplifiedChinese, "[INFO]", "\033[1;46m 信息 \033[0m")
@@ -81,18 +162,33 @@ License GPLv3+: GNU GPL version 3 or later <https://gnu.org/licenses/gpl.html>.
 This is free software: you are free to change and redistribute it.
 There is NO WARRANTY, to the extent permitted by law.`)
 	message.SetString(language.English, "usage.b", "Specify ssm backend, possible values")
-	message.SetString(language.English, "usage.n", "Song ID")
-	message.SetString(language.English, "usage.d", "Difficulty of song")
+	message.SetString(language.English, "usage.n", "Song ID (with the `adb` backend, recognized from the song selection screen if omitted)")
+	message.SetString(language.English, "usage.d", "Difficulty of song (with the `adb` backend, recognized from the song selection screen if omitted)")
 	message.SetString(language.English, "usage.e", "Extract assets from assets foler path")
-	message.SetString(language.English, "usage.r", "Device orientation, options: `left` (↺, counter-clockwise), `right` (↻, clockwise). Note: ignored when using `adb` backend")
-	message.SetString(language.English, "usage.p", "Custom chart path (if this is provided, song ID and difficulty will be ignored)")
+	message.SetString(language.English, "usage.r", "Device orientation, options: `left` (↺, counter-clockwise), `right` (↻, clockwise). Note: the `adb` backend only uses it when the screen is in portrait or in UHID mode")
+	message.SetString(language.English, "usage.p", "Custom chart or touch event file path (if this is provided, song ID and difficulty will be ignored)")
+	message.SetString(language.English, "usage.o", "Save generated touch events to the given file and exit (binary format if the extension is `.vte`, JSON otherwise)")
 	message.SetString(language.English, "usage.s", "Specify the device serial (if not provided, ssm will use the first device serial)")
 	message.SetString(language.English, "usage.k", "Switch to PJSK mode")
+	message.SetString(language.English, "usage.l", "Stage layout name (`bang` or `pjsk` by default, depending on PJSK mode), custom layouts can be added in `layouts.json`")
+	message.SetString(language.English, "usage.c", "Calibration mode: tap reference points, nudge them with arrow keys, then fit the judge line and save it to the device config")
+	message.SetString(language.English, "usage.w", "Recording file `path` of the `record-hid` and `record-adb` backends")
+	message.SetString(language.English, "usage.u", "With the `adb` backend, send touches through a virtual UHID touchscreen created by scrcpy (requires scrcpy 3.x)")
+	message.SetString(language.English, "usage.m", "With the `adb` backend, limit the long side of the video stream to this many pixels (0 to use the value in config)")
+	message.SetString(language.English, "usage.a", "With the `adb` backend, audio `source` of scrcpy, e.g. `output`, `playback` (empty to use the value in config, audio is disabled by default)")
+	message.SetString(language.English, "usage.x", "With `-a`, a WAV `file` of the song audio from the time 0 of the chart, used to find where the song starts in the device audio (empty to align with the notes of the chart)")
+	message.SetString(language.English, "usage.f", "With the `adb` backend, record the screen to this `file` without re-encoding (the format is chosen by the extension, e.g. `.mkv`, `.mp4`)")
+	message.SetString(language.English, "usage.t", "With the `adb` backend, play unattended for this many `rounds`: tap through the result screens and start again, the screens must be measured in screens.json")
+	message.SetString(language.English, "usage.i", "With `-t`, play the next song in the list in each round instead of the same one")
 	message.SetString(language.English, "usage.g", "Show debug info")
 	message.SetString(language.English, "usage.v", "Show ssm's version information and exit")
 	message.SetString(language.English, "ui line 0", "\x1b[7m\x1b[1m ENTER/SPACE \x1b[0m GO!!!!!")
 	message.SetString(language.English, "ui line 1", "\x1b[7m\x1b[1m ← \x1b[0m -10ms   \x1b[7m\x1b[1m Shift-← \x1b[0m -50ms   \x1b[7m\x1b[1m Ctrl-← \x1b[0m -100ms   \x1b[7m\x1b[1m Ctrl-C \x1b[0m Stop")
 	message.SetString(language.English, "ui line 2", "\x1b[7m\x1b[1m → \x1b[0m +10ms   \x1b[7m\x1b[1m Shift-→ \x1b[0m +50ms   \x1b[7m\x1b[1m Ctrl-→ \x1b[0m +100ms                ")
+	message.SetString(language.English, "ui line 3", "\x1b[7m\x1b[1m ↑ \x1b[0m +0.01%% speed   \x1b[7m\x1b[1m Shift-↑ \x1b[0m +0.1%%   \x1b[7m\x1b[1m ↓ \x1b[0m -0.01%%   \x1b[7m\x1b[1m Shift-↓ \x1b[0m -0.1%%")
+	message.SetString(language.English, "ui line 4", "\x1b[7m\x1b[1m SPACE \x1b[0m Pause/Resume   \x1b[7m\x1b[1m [ \x1b[0m Previous bar   \x1b[7m\x1b[1m ] \x1b[0m Next bar   \x1b[7m\x1b[1m Esc \x1b[0m Stop")
+	message.SetString(language.English, "calibration hint: lane %d", "ssm taps where lane %d meets the judge line. Nudge the point until the tap lands on the center of the lane, right on the judge line.")
+	message.SetString(language.English, "calibration keys", "\x1b[7m\x1b[1m ←↑↓→ \x1b[0m 1px   \x1b[7m\x1b[1m Shift \x1b[0m 10px   \x1b[7m\x1b[1m Ctrl \x1b[0m 50px   \x1b[7m\x1b[1m ENTER/SPACE \x1b[0m Confirm   \x1b[7m\x1b[1m Esc \x1b[0m Abort")
 	message.SetString(language.English, "[FATAL]", "\033[1;41m FATAL \033[0m")
 	message.SetString(language.English, "[WARN]", "\033[1;45m WARN \033[0m")
 	message.SetString(language.English, "[INFO]", "\033[1;46m INFO \033[0m")
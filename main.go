@@ -7,10 +7,12 @@ import (
 	"context"
 	"crypto"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,15 +22,17 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/kvarenzn/ssm/adb"
 	"github.com/kvarenzn/ssm/common"
 	"github.com/kvarenzn/ssm/config"
 	"github.com/kvarenzn/ssm/controllers"
 	"github.com/kvarenzn/ssm/db"
 	"github.com/kvarenzn/ssm/log"
+	"github.com/kvarenzn/ssm/player"
+	"github.com/kvarenzn/ssm/scheduler"
 	"github.com/kvarenzn/ssm/scores"
 	"github.com/kvarenzn/ssm/stage"
 	"github.com/kvarenzn/ssm/term"
+	"github.com/kvarenzn/ssm/vision"
 	"golang.org/x/image/draw"
 
 	"github.com/kvarenzn/ssm/locale"
@@ -38,31 +42,45 @@ var SSM_VERSION = "(unknown)"
 
 // flags
 var (
-	backend      string
-	songID       int
-	difficulty   string
-	extract      string
-	direction    string
-	chartPath    string
-	deviceSerial string
-	showDebugLog bool
-	showVersion  bool
-	pjskMode     bool
+	backend       string
+	songID        int
+	difficulty    string
+	extract       string
+	direction     string
+	chartPath     string
+	outputPath    string
+	deviceSerial  string
+	showDebugLog  bool
+	showVersion   bool
+	pjskMode      bool
+	layoutName    string
+	calibrateMode bool
+	recordPath    string
+	uhidMode      bool
+	maxSize       int
+	audioSource   string
+	referencePath string
+	videoPath     string
+	repeatTimes   int
+	nextSongMode  bool
 )
 
-const (
-	SERVER_FILE_VERSION      = "3.3.1"
-	SERVER_FILE              = "scrcpy-server-v" + SERVER_FILE_VERSION
-	SERVER_FILE_DOWNLOAD_URL = "https://github.com/Genymobile/scrcpy/releases/download/v" + SERVER_FILE_VERSION + "/" + SERVER_FILE
-	SERVER_FILE_SHA256       = "a0f70b20aa4998fbf658c94118cd6c8dab6abbb0647a3bdab344d70bc1ebcbb8"
-)
+func sha256Of(data []byte) string {
+	h := crypto.SHA256.New()
+	if _, err := h.Write(data); err != nil {
+		log.Die("Failed to calculate sha256 of `scrcpy-server`:", err)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
 
-func downloadServer() {
-	log.Infof("To use adb as the backend, the third-party component `scrcpy-server` (version %s) is required.", SERVER_FILE_VERSION)
+func downloadServer(opts *config.ScrcpyOptions, checksum string) {
+	url := controllers.ScrcpyServerDownloadURL(opts.Version)
+	log.Infof("To use adb as the backend, the third-party component `scrcpy-server` (version %s) is required.", opts.Version)
 	log.Infoln("This component is developed by Genymobile and licensed under Apache License 2.0.")
 	log.Infoln()
 	log.Infoln("Please download it from the official release page and place it in the same directory as `ssm.exe`.")
-	log.Infoln("Download link:", SERVER_FILE_DOWNLOAD_URL)
+	log.Infoln("Download link:", url)
 	log.Infoln()
 	log.Infoln("Alternatively, ssm can automatically handle this process for you.")
 	log.Info("Proceed with automatic download? [Y/n]: ")
@@ -78,7 +96,7 @@ func downloadServer() {
 
 	log.Infoln("Downloading... Please wait.")
 
-	res, err := http.Get(SERVER_FILE_DOWNLOAD_URL)
+	res, err := http.Get(url)
 	if err != nil {
 		log.Dieln("Failed to download `scrcpy-server`.",
 			locale.P.Sprintf("Error: %s", err),
@@ -92,41 +110,36 @@ func downloadServer() {
 			"You may try again later, download it manually, or use `hid` backend instead.")
 	}
 
-	h := crypto.SHA256.New()
-	if _, err := h.Write(data); err != nil {
-		log.Die("Failed to calculate sha256 of `scrcpy-server`:", err)
-	}
-
-	if fmt.Sprintf("%x", h.Sum(nil)) != SERVER_FILE_SHA256 {
+	if sha256Of(data) != checksum {
 		log.Die("Checksum mismatch. Please try again later.")
 	}
 
-	if err := os.WriteFile(SERVER_FILE, data, 0o644); err != nil {
+	if err := os.WriteFile(opts.ServerPath, data, 0o644); err != nil {
 		log.Die("Failed to save `scrcpy-server` to disk:", err)
 	}
 }
 
-func checkOrDownload() {
-	if _, err := os.Stat(SERVER_FILE); err != nil {
+func checkOrDownload(opts *config.ScrcpyOptions) {
+	checksum, ok := controllers.ScrcpyServerChecksum(opts.Version)
+	if !ok {
+		log.Dief("Unsupported `scrcpy-server` version: %s, supported: %s", opts.Version, strings.Join(controllers.ScrcpyServerVersions(), ", "))
+	}
+
+	if _, err := os.Stat(opts.ServerPath); err != nil {
 		if !os.IsNotExist(err) {
 			log.Die("Failed to locate server file:", err)
 		}
 
-		downloadServer()
+		downloadServer(opts, checksum)
 	} else {
-		data, err := os.ReadFile(SERVER_FILE)
+		data, err := os.ReadFile(opts.ServerPath)
 		if err != nil {
 			log.Die("Failed to read the content of `scrcpy-server`:", err)
 		}
 
-		h := crypto.SHA256.New()
-		if _, err := h.Write(data); err != nil {
-			log.Die("Failed to calculate sha256 of `scrcpy-server`:", err)
-		}
-
-		if fmt.Sprintf("%x", h.Sum(nil)) != SERVER_FILE_SHA256 {
+		if sha256Of(data) != checksum {
 			log.Warn("Checksum mismatch. File may be corrupted.")
-			downloadServer()
+			downloadServer(opts, checksum)
 		}
 	}
 }
@@ -141,17 +154,24 @@ type tui struct {
 	db             db.MusicDatabase
 	size           *term.TermSize
 	playing        bool
-	start          time.Time
-	offset         int
-	controller     controllers.Controller
-	events         []common.ViscousEventItem
-	firstTick      int64
+	syncing        bool          // waiting for the first note in the video
+	listening      bool          // waiting for the song in the audio
+	synced         bool          // started by the video instead of a key
+	audioSynced    bool          // started by the audio instead of a key
+	latency        time.Duration // of the video frame the start is measured from
+	reference      []float64     // onset envelope the audio is aligned with
+	songReference  bool          // the reference is the song audio of `-x`, which can be aligned before the first note
+	session        *player.Session
+	lateness       []scheduler.Stats // of each play
 	loadFailed     bool
 	orignal        image.Image
 	scaled         image.Image
 	graphicsMethod term.GraphicsMethod
-	renderMutex    *sync.Mutex
+	renderMutex    *sync.Mutex // guards the terminal, and the fields from playing to latency as they are rendered from other goroutines
 	sigwinch       chan os.Signal
+	startKey       chan struct{} // ENTER/SPACE pressed before playing
+	stdinClosed    chan struct{} // closed when stdin reaches EOF, no more keys then
+	abort          func()        // stops the play, bound to Esc
 }
 
 func newTui(database db.MusicDatabase) *tui {
@@ -159,10 +179,33 @@ func newTui(database db.MusicDatabase) *tui {
 		db:          database,
 		renderMutex: &sync.Mutex{},
 		sigwinch:    make(chan os.Signal, 1),
+		startKey:    make(chan struct{}, 1),
+		stdinClosed: make(chan struct{}),
 	}
 }
 
-func (t *tui) init(controller controllers.Controller, events []common.ViscousEventItem) error {
+var errNoStartSignal = errors.New("stdin is closed and there is nothing to sync with, the start can not be signaled")
+
+// currentChart describes the chart selected by the flags
+func currentChart(notes []time.Duration, bars scores.Bars) player.Chart {
+	chart := player.Chart{SongID: songID, Difficulty: difficulty, Notes: notes}
+	if chartPath != "" {
+		chart = player.Chart{SongID: -1, Path: chartPath, Notes: notes}
+	}
+
+	for _, bar := range bars {
+		chart.Bars = append(chart.Bars, time.Duration(math.Round(bar*1000))*time.Millisecond)
+	}
+	return chart
+}
+
+func (t *tui) init(controller controllers.Controller, events []common.ViscousEventItem, chart player.Chart) error {
+	t.session = player.NewSession(controller, scheduler.System)
+	t.session.Load(chart, events)
+	t.session.Observe(func(*player.Session, player.Event) {
+		t.render(false)
+	})
+
 	if err := term.PrepareTerminal(); err != nil {
 		return err
 	}
@@ -175,9 +218,6 @@ func (t *tui) init(controller controllers.Controller, events []common.ViscousEve
 		return err
 	}
 
-	t.controller = controller
-	t.events = events
-
 	t.startListenResize()
 
 	term.SetWindowTitle(locale.P.Sprintf("ssm: READY"))
@@ -194,11 +234,12 @@ func (t *tui) loadJacket() error {
 		}
 	}
 
-	if chartPath != "" {
+	chart := t.session.Chart()
+	if chart.Path != "" {
 		return fmt.Errorf("No song ID provided")
 	}
 
-	thumb, jacket := t.db.Jacket(songID)
+	thumb, jacket := t.db.Jacket(chart.SongID)
 	if thumb == "" {
 		return fmt.Errorf("Jacket not found")
 	}
@@ -376,83 +417,207 @@ func (t *tui) render(full bool) {
 
 	t.emptyLine()
 
-	if chartPath == "" {
-		t.pcenterln(fmt.Sprintf("%s%s", displayDifficulty(), t.db.Title(songID, "\x1b[1m${title}\x1b[0m")))
-		t.pcenterln(t.db.Title(songID, "${artist}"))
+	if chart := t.session.Chart(); chart.Path == "" {
+		t.pcenterln(fmt.Sprintf("%s%s", displayDifficulty(), t.db.Title(chart.SongID, "\x1b[1m${title}\x1b[0m")))
+		t.pcenterln(t.db.Title(chart.SongID, "${artist}"))
 	} else {
-		t.pcenterln(chartPath)
+		t.pcenterln(chart.Path)
 	}
 
 	t.emptyLine()
 
 	if !t.playing {
 		t.pcenterln(locale.P.Sprintf("ui line 0"))
+		if t.syncing {
+			t.pcenterln(locale.P.Sprintf("Waiting for the first note in the video..."))
+		} else if t.listening {
+			t.pcenterln(locale.P.Sprintf("Waiting for the song in the audio..."))
+		} else {
+			t.emptyLine()
+		}
+		t.emptyLine()
+		t.emptyLine()
+		t.emptyLine()
 		t.emptyLine()
 		t.emptyLine()
 	} else {
-		t.pcenterln(locale.P.Sprintf("Offset: %d ms", t.offset))
+		offset, scale := t.session.Offset(), t.session.Scale()
+		if t.synced {
+			t.pcenterln(locale.P.Sprintf("Offset: %d ms, synced with the video (latency %d ms)", offset, t.latency.Milliseconds()))
+		} else if t.audioSynced {
+			t.pcenterln(locale.P.Sprintf("Offset: %d ms, synced with the audio", offset))
+		} else {
+			t.pcenterln(locale.P.Sprintf("Offset: %d ms", offset))
+		}
+		if hits := t.session.Estimated(); hits > 0 {
+			t.pcenterln(locale.P.Sprintf("Speed: %+.3f%%, estimated from %d hits", (scale-1)*100, hits))
+		} else {
+			t.pcenterln(locale.P.Sprintf("Speed: %+.3f%%", (scale-1)*100))
+		}
+		if t.session.State() == player.StatePaused {
+			t.pcenterln(locale.P.Sprintf("Paused at %s, press SPACE to resume", position(t.session.Position())))
+		} else if stats := t.session.Stats(); stats.Count > 0 {
+			t.pcenterln(locale.P.Sprintf("Lateness: p50 %s, p99 %s, max %s", ms(stats.P50), ms(stats.P99), ms(stats.Max)))
+		} else {
+			t.emptyLine()
+		}
 		t.pcenterln(locale.P.Sprintf("ui line 1"))
 		t.pcenterln(locale.P.Sprintf("ui line 2"))
+		t.pcenterln(locale.P.Sprintf("ui line 3"))
+		t.pcenterln(locale.P.Sprintf("ui line 4"))
 	}
 
 	t.renderMutex.Unlock()
 }
 
-func (t *tui) begin() {
-	t.firstTick = t.events[0].Timestamp
+// begin waits for the first note to reach the judge line, either seen in the video, heard in the audio or signaled with ENTER/SPACE
+func (t *tui) begin(ctx context.Context, sync <-chan syncResult, aligned <-chan audioAlignment) error {
+	firstTick := t.session.FirstTick()
+	clock := t.session.Clock()
+	t.renderMutex.Lock()
+	t.syncing = sync != nil
+	t.listening = aligned != nil
+	t.synced, t.audioSynced = false, false
+	t.renderMutex.Unlock()
+	t.render(false)
 
-	for {
-		key, err := term.ReadKey(os.Stdin, 10*time.Millisecond)
-		if err != nil {
-			log.Dief("Failed to get key from stdin: %s", err)
-		}
+	var firstNote time.Time
+	var synced, audioSynced bool
+	var latency time.Duration
+	stdinClosed := t.stdinClosed
+	for firstNote.IsZero() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case result := <-sync:
+			firstNote = result.at
+			synced = true
+			latency = result.latency
+		case alignment := <-aligned:
+			at := alignment.start.Add(time.Duration(firstTick) * time.Millisecond)
+			if at.Before(clock.Now()) {
+				// too late to start with the first note, e.g. aligned with the notes of the chart
+				continue
+			}
+			firstNote = at
+			audioSynced = true
+		case <-t.startKey:
+			firstNote = clock.Now()
+		case <-stdinClosed:
+			// the last key may be read right before the EOF
+			select {
+			case <-t.startKey:
+				firstNote = clock.Now()
+				continue
+			default:
+			}
 
-		if key == term.KEY_ENTER || key == term.KEY_SPACE {
-			break
+			if sync == nil && aligned == nil {
+				return errNoStartSignal
+			}
+			stdinClosed = nil
 		}
 	}
 
+	t.renderMutex.Lock()
 	t.playing = true
-	t.start = time.Now().Add(-time.Duration(t.firstTick) * time.Millisecond)
-	t.offset = 0
-	if len(chartPath) == 0 {
-		term.SetWindowTitle(locale.P.Sprintf("ssm: Autoplaying %s (%s)", t.db.Title(songID, "${title} :: ${artist}"), strings.ToUpper(difficulty)))
+	t.synced, t.audioSynced, t.latency = synced, audioSynced, latency
+	t.renderMutex.Unlock()
+
+	if chart := t.session.Chart(); chart.Path == "" {
+		term.SetWindowTitle(locale.P.Sprintf("ssm: Autoplaying %s (%s)", t.db.Title(chart.SongID, "${title} :: ${artist}"), strings.ToUpper(chart.Difficulty)))
 	} else {
-		term.SetWindowTitle(locale.P.Sprintf("ssm: Autoplaying %s", chartPath))
+		term.SetWindowTitle(locale.P.Sprintf("ssm: Autoplaying %s", chart.Path))
 	}
-	t.render(false)
+	// the offset and the scale set with the arrow keys in the previous rounds are kept
+	t.session.Start(firstNote)
+	return nil
 }
 
-func (t *tui) addOffset(delta int) {
-	t.offset += delta
-	t.start = t.start.Add(time.Duration(-delta) * time.Millisecond)
-	t.render(false)
+// isPlaying reports whether the play has started, the keys control the play then
+func (t *tui) isPlaying() bool {
+	t.renderMutex.Lock()
+	defer t.renderMutex.Unlock()
+	return t.playing
 }
 
 func (t *tui) waitForKey() {
 	for {
 		key, err := term.ReadKey(os.Stdin, 10*time.Millisecond)
+		if err == io.EOF {
+			// stdin is not interactive (e.g. piped in CI), keep playing without key bindings
+			close(t.stdinClosed)
+			return
+		}
+
 		if err != nil {
 			log.Dief("Failed to get key from stdin: %s", err)
 		}
 
+		if key == term.KEY_ESC {
+			if t.abort != nil {
+				t.abort()
+			}
+			return
+		}
+
+		if !t.isPlaying() {
+			if key == term.KEY_ENTER || key == term.KEY_SPACE {
+				select {
+				case t.startKey <- struct{}{}:
+				default:
+				}
+			}
+			continue
+		}
+
 		switch key {
 		case term.KEY_LEFT:
-			t.addOffset(-10)
+			t.session.AddOffset(-10)
 		case term.KEY_SHIFT_LEFT:
-			t.addOffset(-50)
+			t.session.AddOffset(-50)
 		case term.KEY_CTRL_LEFT:
-			t.addOffset(-100)
+			t.session.AddOffset(-100)
 		case term.KEY_RIGHT:
-			t.addOffset(10)
+			t.session.AddOffset(10)
 		case term.KEY_SHIFT_RIGHT:
-			t.addOffset(50)
+			t.session.AddOffset(50)
 		case term.KEY_CTRL_RIGHT:
-			t.addOffset(100)
+			t.session.AddOffset(100)
+		case term.KEY_UP:
+			t.session.AdjustScale(0.0001)
+		case term.KEY_SHIFT_UP:
+			t.session.AdjustScale(0.001)
+		case term.KEY_DOWN:
+			t.session.AdjustScale(-0.0001)
+		case term.KEY_SHIFT_DOWN:
+			t.session.AdjustScale(-0.001)
+		case term.KEY_SPACE:
+			t.togglePause()
+		case term.KEY_LSQ:
+			t.seekBars(-1)
+		case term.KEY_RSQ:
+			t.seekBars(1)
 		}
 	}
 }
 
+// togglePause pauses the play with every finger lifted, or resumes it from where it was paused
+func (t *tui) togglePause() {
+	switch t.session.State() {
+	case player.StatePlaying:
+		t.session.Pause()
+	case player.StatePaused:
+		t.session.Resume()
+	}
+}
+
+func (t *tui) seekBars(n int) {
+	if err := t.session.SeekBars(n); err != nil {
+		log.Debugln("Failed to seek:", err)
+	}
+}
+
 func (t *tui) deinit() error {
 	if err := term.RestoreTerminal(); err != nil {
 		return err
@@ -462,125 +627,348 @@ func (t *tui) deinit() error {
 	return nil
 }
 
-func (t *tui) autoplay() {
-	current := 0
-	n := len(t.events)
-	for current < n {
-		now := time.Since(t.start).Milliseconds()
-		event := t.events[current]
-		remaining := event.Timestamp - now
+// play sends the events of the chart in time, rendering the lateness meanwhile
+func (t *tui) play(ctx context.Context) error {
+	refreshCtx, stopRefresh := context.WithCancel(ctx)
+	defer stopRefresh()
+	go t.refresh(refreshCtx)
 
-		if remaining <= 0 {
-			t.controller.Send(event.Data)
-			current++
-			continue
+	return t.session.Play(ctx)
+}
+
+// refresh renders the lateness every second during the play
+func (t *tui) refresh(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.render(false)
 		}
+	}
+}
 
-		if remaining > 10 {
-			time.Sleep(time.Duration(remaining-5) * time.Millisecond)
-		} else if remaining > 4 {
-			time.Sleep(1 * time.Millisecond)
+// report logs the lateness of the events sent in each play, after the terminal is restored
+func (t *tui) report() {
+	for i, stats := range t.lateness {
+		if len(t.lateness) == 1 {
+			log.Infof("Lateness of %d events: p50 %s, p99 %s, max %s", stats.Count, ms(stats.P50), ms(stats.P99), ms(stats.Max))
+		} else {
+			log.Infof("Round %d: lateness of %d events: p50 %s, p99 %s, max %s", i+1, stats.Count, ms(stats.P50), ms(stats.P99), ms(stats.Max))
 		}
 	}
 }
 
-func getJudgeLineCalculator() stage.JudgeLinePositionCalculator {
+// position formats a position of the chart in milliseconds as minutes and seconds
+func position(chart int64) string {
+	d := time.Duration(chart) * time.Millisecond
+	return fmt.Sprintf("%d:%04.1f", int(d.Minutes()), (d % time.Minute).Seconds())
+}
+
+// ms formats a duration in milliseconds with one decimal
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+}
+
+func getLayoutName() string {
+	if layoutName != "" {
+		return layoutName
+	}
+
 	if pjskMode {
-		return stage.PJSKJudgeLinePos
-	} else {
-		return stage.BanGJudgeLinePos
+		return "pjsk"
 	}
+
+	return "bang"
 }
 
-func (t *tui) adbBackend(conf *config.Config, rawEvents common.RawVirtualEvents) {
-	checkOrDownload()
-	if err := adb.StartADBServer("localhost", 5037); err != nil && err != adb.ErrADBServerRunning {
-		log.Fatal(err)
+func getLayoutSpec() *stage.LayoutSpec {
+	name := getLayoutName()
+	spec, ok := stage.Get(name)
+	if !ok {
+		log.Dief("Unknown stage layout: %q, available: %s", name, strings.Join(stage.Names(), ", "))
 	}
 
-	client := adb.NewDefaultClient()
-	devices, err := client.Devices()
-	if err != nil {
-		log.Fatal(err)
+	return spec
+}
+
+func getLayoutCalculator(dc *config.DeviceConfig) stage.LayoutCalculator {
+	spec := getLayoutSpec()
+	calibration := dc.Calibrations[getLayoutName()]
+	if calibration == nil {
+		return spec.Layout
+	}
+
+	// measured on the whole landscape screen, scaled to the size asked for (e.g. a downscaled video frame)
+	return func(width, height float64) *stage.Layout {
+		layout := spec.Layout(width, height)
+		layout.Left, layout.JudgeY = dc.Scale(calibration.Left, calibration.JudgeY, width, height)
+		layout.Right, _ = dc.Scale(calibration.Right, 0, width, height)
+		return layout
 	}
+}
 
-	if len(devices) == 0 {
-		log.Die(errNoDevice)
+func scrcpyOptionsOf(conf *config.Config) *config.ScrcpyOptions {
+	scrcpyOptions := controllers.WithScrcpyDefaults(conf.Scrcpy)
+	if maxSize > 0 {
+		scrcpyOptions.MaxSize = maxSize
 	}
+	if audioSource != "" {
+		scrcpyOptions.AudioSource = audioSource
+	}
+	return scrcpyOptions
+}
 
-	log.Debugln("ADB devices:", devices)
+// connect opens the device selected by the flags, with `opts.Device` filled from the config
+func connect(conf *config.Config, opts controllers.Options) (controllers.Controller, *config.DeviceConfig) {
+	b, ok := controllers.Get(backend)
+	if !ok {
+		log.Dief("Unknown backend: %q", backend)
+	}
 
-	var device *adb.Device
-	if deviceSerial == "" {
-		device = adb.FirstAuthorizedDevice(devices)
-		if device == nil {
-			log.Die("No authorized devices.")
-		}
-	} else {
-		for _, d := range devices {
-			if d.Serial() == deviceSerial {
-				device = d
-				break
-			}
+	if backend == "adb" {
+		checkOrDownload(opts.Scrcpy)
+	}
+
+	serial := deviceSerial
+	if serial == "" {
+		serials, err := b.Devices()
+		if err != nil {
+			log.Fatal(err)
 		}
+		log.Debugln("Recognized devices:", serials)
 
-		if device == nil {
-			log.Dief("No device has serial `%s`", deviceSerial)
+		if len(serials) == 0 {
+			log.Die(errNoDevice)
 		}
 
-		if !device.Authorized() {
-			log.Dief("Found device with serial number `%s`, but that device is not authorized.", deviceSerial)
+		serial = serials[0]
+	}
+
+	var probe config.SizeProbe
+	if backend == "adb" || backend == "hid" {
+		probe = func() (int, int, error) {
+			return controllers.ProbeScreenSize(serial)
 		}
 	}
 
-	log.Debugln("Selected device:", device)
-	controller := controllers.NewScrcpyController(device)
-	if err := controller.Open("./scrcpy-server-v3.3.1", "3.3.1"); err != nil {
+	opts.Device = conf.Lookup(serial, probe)
+	controller, err := b.Open(serial, &opts)
+	if err != nil {
 		log.Die("Failed to connect to device:", err)
 	}
+
+	return controller, opts.Device
+}
+
+func (t *tui) run(ctx context.Context, conf *config.Config, rawEvents common.RawVirtualEvents, bars scores.Bars) {
+	controller, dc := connect(conf, controllers.Options{
+		TurnRight:  direction == "right",
+		Scrcpy:     scrcpyOptionsOf(conf),
+		RecordPath: recordPath,
+		UHID:       uhidMode,
+		VideoPath:  videoPath,
+	})
 	defer controller.Close()
 
-	dc := conf.Get(device.Serial())
-	events := controller.Preprocess(rawEvents, direction == "right", dc, getJudgeLineCalculator())
+	if calibrateMode {
+		if err := calibrate(conf, dc, controller); err != nil {
+			log.Die("Calibration failed:", err)
+		}
+		return
+	}
 
-	t.init(controller, events)
+	if selectionMissing() {
+		if err := recognizeSelection(controller, t.db); err != nil {
+			log.Die("Failed to recognize the selected song:", err)
+		}
+		rawEvents, _, bars = loadTouchEvents()
+	}
 
-	t.begin()
+	calc := getLayoutCalculator(dc)
+	events, err := controller.Preprocess(rawEvents, calc)
+	if err != nil {
+		log.Die("Failed to preprocess touch events:", err)
+	}
+	notes := noteTimes(rawEvents)
+	t.init(controller, events, currentChart(notes, bars))
+	t.reference = audioReference(notes)
+	t.songReference = referencePath != ""
 
 	go t.waitForKey()
 
-	t.autoplay()
+	var d *driver
+	if repeatTimes > 0 {
+		if d, err = newDriver(controller); err != nil {
+			log.Die("Failed to start repeat play:", err)
+		}
+	}
+
+	for round := range max(repeatTimes, 1) {
+		if d != nil {
+			if round > 0 {
+				// forget the keys pressed during the previous round
+				select {
+				case <-t.startKey:
+				default:
+				}
+
+				if err := t.nextRound(ctx, d, calc); err != nil {
+					stopped(err)
+					return
+				}
+			}
+
+			log.Debugf("Round %d of %d", round+1, repeatTimes)
+			if err := d.advance(ctx, vision.StatePlaying); err != nil {
+				stopped(err)
+				return
+			}
+		}
+
+		t.renderMutex.Lock()
+		t.playing = false
+		t.renderMutex.Unlock()
+
+		syncCtx, stopSync := context.WithCancel(ctx)
+		video := syncFromVideo(syncCtx, controller, dc, calc)
+		aligned := syncFromAudio(syncCtx, controller, t.reference)
+		// the click track is not aligned before the first note is played, it is only for watchDrift
+		startAligned := aligned
+		if !t.songReference {
+			startAligned = nil
+		}
+		err := t.begin(ctx, video, startAligned)
+		if err == nil {
+			go t.watchDrift(syncCtx, video, aligned)
+			err = t.play(ctx)
+			if stats := t.session.Stats(); stats.Count > 0 {
+				t.lateness = append(t.lateness, stats)
+			}
+		}
+		stopSync()
+
+		if err != nil {
+			stopped(err)
+			return
+		}
+	}
 
 	time.Sleep(300 * time.Millisecond) // take a nap
 }
 
-func (t *tui) hidBackend(conf *config.Config, rawEvents common.RawVirtualEvents) {
-	if deviceSerial == "" {
-		serials := controllers.FindHIDDevices()
-		log.Debugln("Recognized devices:", serials)
+// stopped reports why autoplay stopped
+func stopped(err error) {
+	if errors.Is(err, context.Canceled) {
+		// interrupted, the deferred Close() lifts all fingers
+		return
+	}
 
-		if len(serials) == 0 {
-			log.Die(errNoDevice)
-		}
+	term.RestoreTerminal()
+	if errors.Is(err, controllers.ErrDeviceDisconnected) {
+		log.Warn("Device disconnected, autoplay stopped:", err)
+	} else {
+		log.Warn("Autoplay stopped:", err)
+	}
+}
 
-		deviceSerial = serials[0]
+// readTouchEventFileMode takes the mode recorded in the touch event file given with `-p`,
+// before the database and the stage layout are chosen by the mode
+func readTouchEventFileMode() {
+	if chartPath == "" {
+		return
 	}
 
-	dc := conf.Get(deviceSerial)
-	controller := controllers.NewHIDController(dc)
-	controller.Open()
-	defer controller.Close()
+	// reading errors are reported when the events are loaded
+	data, err := os.ReadFile(chartPath)
+	if err != nil {
+		return
+	}
+
+	vteFile, err := scores.DecodeVTEFile(data)
+	if err != nil || vteFile.Chart.Mode == "" {
+		return
+	}
+	pjskMode = vteFile.Chart.Mode == "pjsk"
+}
 
-	events := controller.Preprocess(rawEvents, direction == "right", getJudgeLineCalculator())
-	t.init(controller, events)
+// loadTouchEvents loads the touch events of the selected chart, the start times of its bars are unknown for touch event files
+func loadTouchEvents() (common.RawVirtualEvents, *scores.VTEGenerateConfig, scores.Bars) {
+	var err error
+	if selectionMissing() {
+		log.Die("Song id and difficulty are both required")
+	}
 
-	t.begin()
+	var chartText []byte
+	if chartPath == "" {
+		var pathResults []string
+		if pjskMode {
+			pathResults, err = filepath.Glob(filepath.Join("./assets/sekai/assetbundle/resources/startapp/music/music_score/", fmt.Sprintf("%04d_01/%s.txt", songID, difficulty)))
+		} else {
+			pathResults, err = filepath.Glob(filepath.Join("./assets/star/forassetbundle/startapp/musicscore/", fmt.Sprintf("musicscore*/%03d/*_%s.txt", songID, difficulty)))
+		}
+		if err != nil {
+			log.Die("Failed to find musicscore file:", err)
+		}
 
-	go t.waitForKey()
+		if len(pathResults) < 1 {
+			log.Die("Musicscore not found")
+		}
 
-	t.autoplay()
+		log.Debugln("Musicscore loaded:", pathResults[0])
+		chartText, err = os.ReadFile(pathResults[0])
+	} else {
+		log.Debugln("Musicscore loaded:", chartPath)
+		chartText, err = os.ReadFile(chartPath)
+	}
 
-	time.Sleep(300 * time.Millisecond) // take a nap
+	if err != nil {
+		log.Die("Failed to load musicscore:", err)
+	}
+
+	var rawEvents common.RawVirtualEvents
+	var genConfig *scores.VTEGenerateConfig
+	var bars scores.Bars
+	vteFile, err := scores.DecodeVTEFile(chartText)
+	if err == nil {
+		log.Debugf("Touch event file loaded, %d event group(s)", len(vteFile.Events))
+		rawEvents = vteFile.Events
+		genConfig = vteFile.Profile
+	} else if err != scores.ErrNotVTEFile {
+		log.Die("Failed to load touch event file:", err)
+	} else {
+		var chart scores.Chart
+		if pjskMode {
+			chart, bars, err = scores.ParseSUS(string(chartText))
+			if err != nil {
+				log.Die("Failed to parse musicscore:", err)
+			}
+		} else {
+			chart, bars = scores.ParseBMS(string(chartText))
+		}
+
+		genConfig = &scores.VTEGenerateConfig{
+			TapDuration:         10,
+			FlickDuration:       60,
+			FlickReportInterval: 5,
+			FlickFactor:         1.0 / 5,
+			FlickPow:            1,
+			SlideReportInterval: 10,
+			SlideMaxError:       0.005,
+			SlideMinInterval:    4,
+		}
+		if pjskMode {
+			genConfig.FlickFactor = 1.0 / 6
+			genConfig.FlickDuration = 20
+			genConfig.ContactDepth = 0.01
+		}
+		rawEvents = scores.GenerateTouchEvent(genConfig, chart)
+	}
+
+	return rawEvents, genConfig, bars
 }
 
 func main() {
@@ -600,8 +988,19 @@ func main() {
 	flag.StringVar(&extract, "e", "", p.Sprintf("usage.e"))
 	flag.StringVar(&direction, "r", "left", p.Sprintf("usage.r"))
 	flag.StringVar(&chartPath, "p", "", p.Sprintf("usage.p"))
+	flag.StringVar(&outputPath, "o", "", p.Sprintf("usage.o"))
 	flag.StringVar(&deviceSerial, "s", "", p.Sprintf("usage.s"))
 	flag.BoolVar(&pjskMode, "k", false, p.Sprintf("usage.k"))
+	flag.StringVar(&layoutName, "l", "", p.Sprintf("usage.l"))
+	flag.BoolVar(&calibrateMode, "c", false, p.Sprintf("usage.c"))
+	flag.StringVar(&recordPath, "w", "record.jsonl", p.Sprintf("usage.w"))
+	flag.BoolVar(&uhidMode, "u", false, p.Sprintf("usage.u"))
+	flag.IntVar(&maxSize, "m", 0, p.Sprintf("usage.m"))
+	flag.StringVar(&audioSource, "a", "", p.Sprintf("usage.a"))
+	flag.StringVar(&referencePath, "x", "", p.Sprintf("usage.x"))
+	flag.StringVar(&videoPath, "f", "", p.Sprintf("usage.f"))
+	flag.IntVar(&repeatTimes, "t", 0, p.Sprintf("usage.t"))
+	flag.BoolVar(&nextSongMode, "i", false, p.Sprintf("usage.i"))
 	flag.BoolVar(&showDebugLog, "g", false, p.Sprintf("usage.g"))
 	flag.BoolVar(&showVersion, "v", false, p.Sprintf("usage.v"))
 
@@ -635,6 +1034,8 @@ func main() {
 		return
 	}
 
+	readTouchEventFileMode()
+
 	var database db.MusicDatabase
 	if pjskMode {
 		database, err = db.NewSekaiDB()
@@ -652,87 +1053,88 @@ func main() {
 	}
 
 	const CONFIG_PATH = "./config.json"
+	const LAYOUTS_PATH = "./layouts.json"
+	const SCREENS_PATH = "./screens.json"
 
-	conf, err := config.Load(CONFIG_PATH)
-	if err != nil {
-		log.Die(err)
-	}
-
-	if chartPath == "" && (songID == -1 || difficulty == "") {
-		log.Die("Song id and difficulty are both required")
-	}
-
-	var chartText []byte
-	if chartPath == "" {
-		var pathResults []string
-		if pjskMode {
-			pathResults, err = filepath.Glob(filepath.Join("./assets/sekai/assetbundle/resources/startapp/music/music_score/", fmt.Sprintf("%04d_01/%s.txt", songID, difficulty)))
-		} else {
-			pathResults, err = filepath.Glob(filepath.Join("./assets/star/forassetbundle/startapp/musicscore/", fmt.Sprintf("musicscore*/%03d/*_%s.txt", songID, difficulty)))
-		}
-		if err != nil {
-			log.Die("Failed to find musicscore file:", err)
+	if _, err := os.Stat(LAYOUTS_PATH); err == nil {
+		if err := stage.Load(LAYOUTS_PATH); err != nil {
+			log.Die("Failed to load stage layouts:", err)
 		}
+		log.Debugln("Stage layouts loaded:", stage.Names())
+	}
 
-		if len(pathResults) < 1 {
-			log.Die("Musicscore not found")
+	if _, err := os.Stat(SCREENS_PATH); err == nil {
+		if err := vision.Load(SCREENS_PATH); err != nil {
+			log.Die("Failed to load screen specs:", err)
 		}
-
-		log.Debugln("Musicscore loaded:", pathResults[0])
-		chartText, err = os.ReadFile(pathResults[0])
-	} else {
-		log.Debugln("Musicscore loaded:", chartPath)
-		chartText, err = os.ReadFile(chartPath)
+		log.Debugln("Screen specs loaded:", vision.Names())
 	}
 
+	conf, err := config.Load(CONFIG_PATH)
 	if err != nil {
-		log.Die("Failed to load musicscore:", err)
+		log.Die(err)
 	}
 
-	var chart scores.Chart
-	if pjskMode {
-		chart, err = scores.ParseSUS(string(chartText))
-		if err != nil {
-			log.Die("Failed to parse musicscore:", err)
+	if flag.Arg(0) == "screenshot" {
+		if err := screenshot(conf, flag.Arg(1)); err != nil {
+			log.Die("Failed to take screenshot:", err)
 		}
-	} else {
-		chart = scores.ParseBMS(string(chartText))
+		return
 	}
 
-	genConfig := &scores.VTEGenerateConfig{
-		TapDuration:         10,
-		FlickDuration:       60,
-		FlickReportInterval: 5,
-		FlickFactor:         1.0 / 5,
-		FlickPow:            1,
-		SlideReportInterval: 10,
-	}
-	if pjskMode {
-		genConfig.FlickFactor = 1.0 / 6
-		genConfig.FlickDuration = 20
+	// without the song ID or the difficulty, they are read from the screen after connecting to the device
+	inferSelection := backend == "adb" && outputPath == "" && selectionMissing()
+
+	var rawEvents common.RawVirtualEvents
+	var bars scores.Bars
+	if !calibrateMode && !inferSelection {
+		var genConfig *scores.VTEGenerateConfig
+		rawEvents, genConfig, bars = loadTouchEvents()
+
+		if outputPath != "" {
+			info := scores.VTEChartInfo{
+				Path:       chartPath,
+				Difficulty: difficulty,
+				Mode:       "bang",
+			}
+			if chartPath == "" {
+				info.SongID = songID
+			}
+			if pjskMode {
+				info.Mode = "pjsk"
+			}
+
+			if err := scores.NewVTEFile(info, genConfig, rawEvents).Save(outputPath); err != nil {
+				log.Die("Failed to save touch event file:", err)
+			}
+			log.Infoln("Touch events saved to", outputPath)
+			return
+		}
 	}
-	rawEvents := scores.GenerateTouchEvent(genConfig, chart)
 
 	t := newTui(database)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT)
 	defer stop()
+	t.abort = stop
 
+	done := make(chan struct{})
 	go func() {
-		switch backend {
-		case "adb":
-			t.adbBackend(conf, rawEvents)
-		case "hid":
-			t.hidBackend(conf, rawEvents)
-		default:
-			log.Dief("Unknown backend: %q", backend)
-		}
+		t.run(ctx, conf, rawEvents, bars)
+		close(done)
 		stop()
 	}()
 
 	<-ctx.Done()
 
+	// give the controller a chance to release the pointers
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+	}
+
 	if err := t.deinit(); err != nil {
 		log.Die(err)
 	}
+	t.report()
 }
@@ -0,0 +1,64 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package player
+
+import "fmt"
+
+// Event is what happened to a session
+type Event int
+
+const (
+	Loaded Event = iota
+	Started
+	OffsetChanged
+	ScaleChanged
+	Paused
+	Resumed
+	Seeked
+	Finished
+)
+
+func (e Event) String() string {
+	switch e {
+	case Loaded:
+		return "loaded"
+	case Started:
+		return "started"
+	case OffsetChanged:
+		return "offset-changed"
+	case ScaleChanged:
+		return "scale-changed"
+	case Paused:
+		return "paused"
+	case Resumed:
+		return "resumed"
+	case Seeked:
+		return "seeked"
+	case Finished:
+		return "finished"
+	default:
+		return fmt.Sprintf("Event(%d)", int(e))
+	}
+}
+
+// Observer is called after each event, from the goroutine that caused it.
+// It may read the session but should return quickly, Play may be waiting for it.
+type Observer func(s *Session, e Event)
+
+// Observe adds an observer, it is not called for the events before
+func (s *Session) Observe(o Observer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.observers = append(s.observers, o)
+}
+
+func (s *Session) notify(e Event) {
+	s.mutex.Lock()
+	observers := s.observers
+	s.mutex.Unlock()
+
+	for _, o := range observers {
+		o(s, e)
+	}
+}
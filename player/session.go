@@ -0,0 +1,516 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package player plays touch events on a controller in time with the chart.
+// It knows nothing about the terminal, front-ends drive a Session and observe its events.
+package player
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/drift"
+	"github.com/kvarenzn/ssm/log"
+	"github.com/kvarenzn/ssm/scheduler"
+)
+
+const (
+	maxSendRetries = 3
+
+	// a hit further than this from any note is not one
+	noteMatchWindow = 60 * time.Millisecond
+
+	// SeekBars moves by this much per bar when the bars of the chart are unknown
+	defaultBarLength = 2 * time.Second
+
+	// the scale set by hand stays within 1±maxScaleError, a few times what the clocks may differ
+	maxScaleError = 5 * drift.MaxScaleError
+)
+
+var ErrNotStarted = errors.New("session not started")
+
+// Chart is what is played
+type Chart struct {
+	SongID     int    // -1 for a custom chart
+	Difficulty string // empty for a custom chart
+	Path       string // custom chart or touch event file, empty for a song of the game
+	Notes      []time.Duration
+	Bars       []time.Duration // start of each bar, empty if unknown (e.g. touch event files)
+}
+
+type State int
+
+const (
+	StateIdle State = iota
+	StatePlaying
+	StatePaused
+	StateFinished
+)
+
+type Session struct {
+	controller controllers.Controller
+	scheduler  *scheduler.Scheduler
+
+	// guards the fields below
+	mutex      sync.Mutex
+	chart      Chart
+	events     []common.ViscousEventItem
+	state      State
+	start      time.Time // local time of the chart time 0
+	offset     int       // milliseconds
+	scale      float64   // chart time per local time, the clock of the game may run at a slightly different rate
+	autoScale  bool      // the scale is estimated, until it is set by hand
+	hits       int       // the scale is estimated from this many hits, 0 if not yet
+	anchor     time.Time // the scale is changed around this moment, see Anchor
+	current    int       // index of the next event
+	pausedAt   int64     // chart position when paused
+	resumed    chan struct{}
+	generation int // changes when the chart is loaded or seeked, the event being waited for is given up then
+
+	observers []Observer
+}
+
+func NewSession(controller controllers.Controller, clock scheduler.Clock) *Session {
+	return &Session{
+		controller: controller,
+		scheduler:  scheduler.New(clock),
+		scale:      1,
+		autoScale:  true,
+	}
+}
+
+// Load loads the events of a chart to play, the offset and the scale are kept
+func (s *Session) Load(chart Chart, events []common.ViscousEventItem) {
+	s.mutex.Lock()
+	s.chart = chart
+	s.events = events
+	s.state = StateIdle
+	s.current = 0
+	s.generation++
+	s.mutex.Unlock()
+
+	s.notify(Loaded)
+}
+
+func (s *Session) Controller() controllers.Controller {
+	return s.controller
+}
+
+func (s *Session) Clock() scheduler.Clock {
+	return s.scheduler.Clock()
+}
+
+func (s *Session) Chart() Chart {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.chart
+}
+
+// FirstTick is the time of the first event in milliseconds, -1 if there are none
+func (s *Session) FirstTick() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.events) == 0 {
+		return -1
+	}
+	return s.events[0].Timestamp
+}
+
+func (s *Session) State() State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.state
+}
+
+// Offset is in milliseconds, positive to play earlier
+func (s *Session) Offset() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.offset
+}
+
+func (s *Session) Scale() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.scale
+}
+
+// Estimated returns the number of hits the scale is estimated from, 0 if it is not estimated
+func (s *Session) Estimated() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.autoScale {
+		return 0
+	}
+	return s.hits
+}
+
+// AutoScale reports whether the scale may be estimated, it may not once set by hand
+func (s *Session) AutoScale() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.autoScale
+}
+
+// Anchor is when the play started or was last resumed or seeked, hits are measured from it
+func (s *Session) Anchor() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.anchor
+}
+
+// Stats returns the lateness of the events sent in the current play
+func (s *Session) Stats() scheduler.Stats {
+	return s.scheduler.Stats()
+}
+
+// Start starts the play when the first note reaches the judge line at firstNote, Play sends the events then
+func (s *Session) Start(firstNote time.Time) {
+	s.mutex.Lock()
+	firstTick := int64(0)
+	if len(s.events) > 0 {
+		firstTick = s.events[0].Timestamp
+	}
+
+	s.state = StatePlaying
+	s.anchor = firstNote
+	s.hits = 0
+	// the offset and the scale set in the previous plays are kept
+	s.start = firstNote.Add(-time.Duration(float64(firstTick+int64(s.offset)) / s.scale * float64(time.Millisecond)))
+	s.mutex.Unlock()
+
+	s.notify(Started)
+}
+
+func (s *Session) chartTime(at time.Time) int64 {
+	if s.state == StatePaused {
+		return s.pausedAt
+	}
+	return int64(float64(at.Sub(s.start)) * s.scale / float64(time.Millisecond))
+}
+
+func (s *Session) localTime(chart int64) time.Time {
+	return s.start.Add(time.Duration(float64(chart) * float64(time.Millisecond) / s.scale))
+}
+
+// ChartTime returns the position of the chart at the local time, in milliseconds
+func (s *Session) ChartTime(at time.Time) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.chartTime(at)
+}
+
+// Position returns the current position of the chart, in milliseconds
+func (s *Session) Position() int64 {
+	return s.ChartTime(s.Clock().Now())
+}
+
+// LocalTime returns when the chart reaches the position in milliseconds
+func (s *Session) LocalTime(chart int64) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.localTime(chart)
+}
+
+// AddOffset plays delta milliseconds earlier
+func (s *Session) AddOffset(delta int) {
+	s.mutex.Lock()
+	s.offset += delta
+	s.start = s.start.Add(time.Duration(-delta) * time.Millisecond)
+	s.pausedAt += int64(delta)
+	s.mutex.Unlock()
+
+	s.notify(OffsetChanged)
+}
+
+func (s *Session) setScale(scale float64, pivot time.Time) {
+	scale = min(max(scale, 1-maxScaleError), 1+maxScaleError)
+	elapsed := float64(pivot.Sub(s.start)) * s.scale / scale
+	s.start = pivot.Add(-time.Duration(elapsed))
+	s.scale = scale
+}
+
+// AdjustScale changes the scale from now on by hand, within 1±5%. It is not estimated any more
+func (s *Session) AdjustScale(delta float64) {
+	s.mutex.Lock()
+	s.autoScale = false
+	s.setScale(s.scale+delta, s.scheduler.Clock().Now())
+	s.mutex.Unlock()
+
+	s.notify(ScaleChanged)
+}
+
+// EstimateScale sets the scale estimated from hits, around the anchor so that the drift since then is corrected as well.
+// It is ignored once the scale is set by hand.
+//
+// Only the slope of the fitted line is taken. Its offset carries the latency of the video or the audio that
+// can not be measured (encoding, transfer), which the offset set with the keys makes up for, and it would
+// move the chart each time the hits come from another source. A constant latency leaves the slope alone.
+func (s *Session) EstimateScale(scale float64, hits int) {
+	s.mutex.Lock()
+	if !s.autoScale || s.state != StatePlaying {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.hits = hits
+	s.setScale(scale, s.anchor)
+	s.mutex.Unlock()
+
+	s.notify(ScaleChanged)
+}
+
+// NearestNote returns the note that should reach the judge line at the local time
+func (s *Session) NearestNote(at time.Time) (time.Duration, bool) {
+	s.mutex.Lock()
+	chart := time.Duration(s.chartTime(at)) * time.Millisecond
+	notes := s.chart.Notes
+	s.mutex.Unlock()
+
+	i := sort.Search(len(notes), func(i int) bool {
+		return notes[i] >= chart
+	})
+
+	best, found := time.Duration(0), false
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(notes) {
+			continue
+		}
+
+		if d := (notes[j] - chart).Abs(); d <= noteMatchWindow && (!found || d < (best-chart).Abs()) {
+			best, found = notes[j], true
+		}
+	}
+	return best, found
+}
+
+// Pause freezes the clock of the chart, Play holds the events until resumed
+func (s *Session) Pause() {
+	s.mutex.Lock()
+	if s.state != StatePlaying {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.pausedAt = s.chartTime(s.scheduler.Clock().Now())
+	s.state = StatePaused
+	s.resumed = make(chan struct{})
+	s.mutex.Unlock()
+
+	s.notify(Paused)
+}
+
+// Resume goes on from the position the chart was paused at
+func (s *Session) Resume() {
+	s.mutex.Lock()
+	if s.state != StatePaused {
+		s.mutex.Unlock()
+		return
+	}
+
+	now := s.scheduler.Clock().Now()
+	s.state = StatePlaying
+	s.start = now.Add(-time.Duration(float64(s.pausedAt) * float64(time.Millisecond) / s.scale))
+	s.anchor = now
+	close(s.resumed)
+	s.mutex.Unlock()
+
+	s.notify(Resumed)
+}
+
+// SeekTo moves the chart to the position in milliseconds, the events already due there are skipped
+// but the latest one, as payloads carry the complete touch state.
+func (s *Session) SeekTo(position int64) error {
+	s.mutex.Lock()
+	if s.state != StatePlaying && s.state != StatePaused {
+		s.mutex.Unlock()
+		return ErrNotStarted
+	}
+
+	now := s.scheduler.Clock().Now()
+	if s.state == StatePaused {
+		s.pausedAt = position
+	} else {
+		s.start = now.Add(-time.Duration(float64(position) * float64(time.Millisecond) / s.scale))
+	}
+	s.anchor = now
+	s.current = s.due(position)
+	s.generation++
+	s.mutex.Unlock()
+
+	s.notify(Seeked)
+	return nil
+}
+
+// SeekBars moves the chart by n bars, backwards if negative, to the start of the bar.
+// A bar is taken as 2 seconds long if the bars of the chart are unknown.
+func (s *Session) SeekBars(n int) error {
+	s.mutex.Lock()
+	position := time.Duration(s.chartTime(s.scheduler.Clock().Now())) * time.Millisecond
+	bars := s.chart.Bars
+	s.mutex.Unlock()
+
+	var target time.Duration
+	if len(bars) == 0 {
+		target = max(position+time.Duration(n)*defaultBarLength, 0)
+	} else {
+		// the bar containing the position
+		current := sort.Search(len(bars), func(i int) bool {
+			return bars[i] > position
+		}) - 1
+		target = bars[min(max(current+n, 0), len(bars)-1)]
+	}
+
+	return s.SeekTo(target.Milliseconds())
+}
+
+// due returns the index of the latest event due at the position, 0 if none is
+func (s *Session) due(position int64) int {
+	return max(sort.Search(len(s.events), func(i int) bool {
+		return s.events[i].Timestamp > position
+	})-1, 0)
+}
+
+// release lifts every finger, if the controller can
+func (s *Session) release() {
+	r, ok := s.controller.(controllers.Releaser)
+	if !ok {
+		return
+	}
+
+	if err := r.ReleaseAll(); err != nil {
+		log.Debugln("Failed to release the pointers:", err)
+	}
+}
+
+func (s *Session) send(data []byte) error {
+	var err error
+	for range maxSendRetries {
+		err = s.controller.Send(data)
+		if !errors.Is(err, controllers.ErrTimeout) {
+			return err
+		}
+		log.Debugln("Send timed out, retrying:", err)
+	}
+	return err
+}
+
+// reconnect waits for a disconnected device to come back, and skips to the latest event that is already due
+func (s *Session) reconnect(ctx context.Context, cause error) error {
+	r, ok := s.controller.(controllers.Reconnector)
+	if !ok {
+		return cause
+	}
+
+	log.Debugln("Device disconnected, waiting for it to come back:", cause)
+	if err := r.Reconnect(ctx); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.current = max(s.current, s.due(s.chartTime(s.scheduler.Clock().Now())))
+	s.mutex.Unlock()
+	return nil
+}
+
+// waitResumed lifts the fingers and blocks while the play is paused
+func (s *Session) waitResumed(ctx context.Context) error {
+	s.mutex.Lock()
+	resumed := s.resumed
+	paused := s.state == StatePaused
+	s.mutex.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	s.release()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+		return nil
+	}
+}
+
+// Play sends the events in time until the end of the chart, Start has to be called first.
+// The fingers are lifted when the play is paused, seeked or stopped by ctx.
+func (s *Session) Play(ctx context.Context) error {
+	if s.State() == StateIdle {
+		return ErrNotStarted
+	}
+
+	s.scheduler.Reset()
+	for {
+		if err := s.waitResumed(ctx); err != nil {
+			s.release()
+			return err
+		}
+
+		s.mutex.Lock()
+		if s.current >= len(s.events) {
+			s.state = StateFinished
+			s.mutex.Unlock()
+			break
+		}
+		event := s.events[s.current]
+		generation := s.generation
+		s.mutex.Unlock()
+
+		// given up when paused or seeked, the deadline is read again at least every 50ms while waiting
+		interrupted := false
+		deadline := func() time.Time {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if s.generation != generation || s.state == StatePaused {
+				interrupted = true
+				return time.Time{}
+			}
+			return s.localTime(event.Timestamp)
+		}
+
+		if err := s.scheduler.Wait(ctx, deadline); err != nil {
+			s.release()
+			return err
+		}
+		due := deadline()
+		if interrupted {
+			// the fingers are lifted by waitResumed when paused
+			if s.State() == StatePlaying {
+				s.release()
+			}
+			continue
+		}
+
+		err := s.send(event.Data)
+		if errors.Is(err, controllers.ErrDeviceDisconnected) {
+			err = s.reconnect(ctx, err)
+			if err == nil {
+				continue
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		s.scheduler.Record(due)
+
+		s.mutex.Lock()
+		if s.generation == generation {
+			s.current++
+		}
+		s.mutex.Unlock()
+	}
+
+	s.notify(Finished)
+	return nil
+}
@@ -0,0 +1,497 @@
+package player_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/player"
+	"github.com/kvarenzn/ssm/scheduler"
+	"github.com/kvarenzn/ssm/stage"
+)
+
+var origin = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const tolerance = time.Millisecond
+
+type sent struct {
+	data string
+	at   time.Duration // since origin
+}
+
+// fakeController records what is sent and when, onSend is called before each send.
+// Releasing the fingers is recorded as "release", onRelease is called after it.
+type fakeController struct {
+	clock     *scheduler.FakeClock
+	sent      []sent
+	onSend    func(i int) error
+	onRelease func()
+}
+
+func (c *fakeController) Size() (int, int) {
+	return 1080, 1920
+}
+
+func (c *fakeController) Preprocess(rawEvents common.RawVirtualEvents, calc stage.LayoutCalculator) ([]common.ViscousEventItem, error) {
+	return nil, nil
+}
+
+func (c *fakeController) Send(data []byte) error {
+	if c.onSend != nil {
+		if err := c.onSend(len(c.sent)); err != nil {
+			return err
+		}
+	}
+
+	c.sent = append(c.sent, sent{string(data), c.clock.Now().Sub(origin)})
+	return nil
+}
+
+func (c *fakeController) ReleaseAll() error {
+	c.sent = append(c.sent, sent{"release", c.clock.Now().Sub(origin)})
+	if c.onRelease != nil {
+		c.onRelease()
+	}
+	return nil
+}
+
+func (c *fakeController) Close() error {
+	return nil
+}
+
+// hookClock calls hook once, in the first sleep that reaches at
+type hookClock struct {
+	*scheduler.FakeClock
+	at   time.Time
+	hook func()
+}
+
+func (c *hookClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := c.FakeClock.Sleep(ctx, d); err != nil {
+		return err
+	}
+
+	if c.hook != nil && !c.Now().Before(c.at) {
+		hook := c.hook
+		c.hook = nil
+		hook()
+	}
+	return nil
+}
+
+// reconnectingController is disconnected once, and comes back after a while
+type reconnectingController struct {
+	fakeController
+	down time.Duration
+}
+
+func (c *reconnectingController) Reconnect(ctx context.Context) error {
+	c.clock.Advance(c.down)
+	return nil
+}
+
+func events(timestamps ...int64) []common.ViscousEventItem {
+	items := make([]common.ViscousEventItem, len(timestamps))
+	for i, ts := range timestamps {
+		items[i] = common.ViscousEventItem{Timestamp: ts, Data: []byte(fmt.Sprint(ts))}
+	}
+	return items
+}
+
+func newSession(c controllers.Controller, clock *scheduler.FakeClock, timestamps ...int64) *player.Session {
+	s := player.NewSession(c, clock)
+	s.Load(player.Chart{SongID: -1}, events(timestamps...))
+	return s
+}
+
+func newClock() *scheduler.FakeClock {
+	clock := scheduler.NewFakeClock(origin)
+	clock.Tick = 10 * time.Microsecond
+	clock.Oversleep = time.Millisecond
+	return clock
+}
+
+func expect(t *testing.T, got []sent, want []sent) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("Sent %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if d := got[i].at - want[i].at; got[i].data != want[i].data || d < 0 || d > tolerance {
+			t.Errorf("Sent %s at %v, want %s at %v", got[i].data, got[i].at, want[i].data, want[i].at)
+		}
+	}
+}
+
+func TestPlay(t *testing.T) {
+	clock := newClock()
+	c := &fakeController{clock: clock}
+	s := newSession(c, clock, 1000, 1500, 2000)
+
+	var observed []player.Event
+	s.Observe(func(_ *player.Session, e player.Event) {
+		observed = append(observed, e)
+	})
+
+	if err := s.Play(context.Background()); err != player.ErrNotStarted {
+		t.Errorf("Play before start: got %v, want ErrNotStarted", err)
+	}
+
+	s.Start(origin.Add(time.Second))
+	if err := s.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, c.sent, []sent{{"1000", time.Second}, {"1500", 1500 * time.Millisecond}, {"2000", 2 * time.Second}})
+
+	if s.State() != player.StateFinished {
+		t.Errorf("State: got %v, want finished", s.State())
+	}
+	if stats := s.Stats(); stats.Count != 3 || stats.Max > tolerance {
+		t.Errorf("Stats: got %+v", stats)
+	}
+	if want := []player.Event{player.Started, player.Finished}; !slices.Equal(observed, want) {
+		t.Errorf("Observed %v, want %v", observed, want)
+	}
+}
+
+func TestOffsetAndScale(t *testing.T) {
+	clock := newClock()
+	c := &fakeController{clock: clock}
+	s := newSession(c, clock, 1000, 11000)
+
+	s.AddOffset(100)
+	s.Start(origin.Add(time.Second))
+	s.EstimateScale(1.001, 10)
+	if err := s.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first note is played 100ms earlier, the one 10 seconds of chart later another 10ms earlier
+	expect(t, c.sent, []sent{{"1000", 900 * time.Millisecond}, {"11000", 10890 * time.Millisecond}})
+
+	if s.Estimated() != 10 {
+		t.Errorf("Estimated from %d hits, want 10", s.Estimated())
+	}
+
+	s.AdjustScale(0.001)
+	if !(s.Scale() > 1.0019 && s.Scale() < 1.0021) || s.AutoScale() || s.Estimated() != 0 {
+		t.Errorf("After adjusting by hand: scale %v, auto %v, estimated %d", s.Scale(), s.AutoScale(), s.Estimated())
+	}
+}
+
+// the offset and the scale are changed by the keys and the drift estimation while playing, see `go test -race`
+func TestConcurrentAdjust(t *testing.T) {
+	clock := newClock()
+	c := &fakeController{clock: clock}
+	s := newSession(c, clock, 1000, 2000, 3000, 4000, 5000)
+	s.Start(origin.Add(time.Second))
+
+	done := make(chan struct{})
+	adjusted := make(chan struct{})
+	go func() {
+		defer close(adjusted)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			s.EstimateScale(1+float64(i%3)/1000, i)
+			s.AddOffset(i%3 - 1)
+			s.NearestNote(clock.Now())
+			s.Position()
+		}
+	}()
+
+	err := s.Play(context.Background())
+	close(done)
+	<-adjusted
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.sent) != 5 {
+		t.Errorf("Sent %v, want all 5 events", c.sent)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	clock := newClock()
+	c := &fakeController{clock: clock}
+	s := newSession(c, clock, 1000, 1500, 2000)
+
+	// paused while sending 1500, which is not sent again
+	c.onSend = func(i int) error {
+		if i == 1 {
+			s.Pause()
+			go func() {
+				clock.Advance(5 * time.Second)
+				s.Resume()
+			}()
+		}
+		return nil
+	}
+
+	s.Start(origin.Add(time.Second))
+	if err := s.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// paused at 1500, resumed at 6500
+	expect(t, c.sent, []sent{
+		{"1000", time.Second},
+		{"1500", 1500 * time.Millisecond},
+		{"release", 1500 * time.Millisecond},
+		{"2000", 7 * time.Second},
+	})
+}
+
+func TestScaleBounds(t *testing.T) {
+	clock := newClock()
+	s := newSession(&fakeController{clock: clock}, clock, 1000, 2000)
+	s.Start(origin.Add(time.Second))
+
+	// held down
+	for range 1000 {
+		s.AdjustScale(-0.001)
+	}
+	if s.Scale() != 0.95 {
+		t.Errorf("Scale: got %v, want 0.95", s.Scale())
+	}
+
+	s.AdjustScale(10)
+	if s.Scale() != 1.05 {
+		t.Errorf("Scale: got %v, want 1.05", s.Scale())
+	}
+}
+
+func TestOffsetWhilePaused(t *testing.T) {
+	clock := newClock()
+	s := newSession(&fakeController{clock: clock}, clock, 1000, 2000)
+	s.Start(origin.Add(time.Second))
+
+	clock.Advance(1500 * time.Millisecond)
+	s.Pause()
+	paused := s.Position()
+
+	// played 100ms earlier, so it goes on 100ms further
+	s.AddOffset(100)
+	clock.Advance(5 * time.Second)
+	s.Resume()
+
+	if got, want := s.Position(), paused+100; got < want || got > want+1 {
+		t.Errorf("Position after resuming: got %d, want %d", got, want)
+	}
+}
+
+func TestPauseWhileWaiting(t *testing.T) {
+	fake := newClock()
+	clock := &hookClock{FakeClock: fake, at: origin.Add(1200 * time.Millisecond)}
+	c := &fakeController{clock: fake}
+	s := player.NewSession(c, clock)
+	s.Load(player.Chart{SongID: -1}, events(1000, 1500, 2000))
+
+	// paused while waiting for 1500
+	var pausedAt time.Duration
+	clock.hook = func() {
+		pausedAt = fake.Now().Sub(origin)
+		s.Pause()
+	}
+	c.onRelease = func() {
+		go func() {
+			fake.Advance(5 * time.Second)
+			s.Resume()
+		}()
+	}
+
+	s.Start(origin.Add(time.Second))
+	if err := s.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is sent while paused, 1500 is sent as far after resuming as it was after pausing
+	expect(t, c.sent, []sent{
+		{"1000", time.Second},
+		{"release", pausedAt},
+		{"1500", 6500 * time.Millisecond},
+		{"2000", 7 * time.Second},
+	})
+}
+
+func TestAbort(t *testing.T) {
+	clock := newClock()
+	c := &fakeController{clock: clock}
+	s := newSession(c, clock, 1000, 1500, 2000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.onSend = func(i int) error {
+		if i == 1 {
+			cancel()
+		}
+		return nil
+	}
+
+	s.Start(origin.Add(time.Second))
+	if err := s.Play(ctx); err != context.Canceled {
+		t.Fatalf("Got %v, want context.Canceled", err)
+	}
+
+	expect(t, c.sent, []sent{
+		{"1000", time.Second},
+		{"1500", 1500 * time.Millisecond},
+		{"release", 1500 * time.Millisecond},
+	})
+}
+
+func TestSeek(t *testing.T) {
+	clock := newClock()
+	c := &fakeController{clock: clock}
+	s := newSession(c, clock, 1000, 1500, 2000, 3000)
+
+	c.onSend = func(i int) error {
+		if i == 1 {
+			// sending 1500, jump to 2900
+			if err := s.SeekTo(2900); err != nil {
+				t.Error(err)
+			}
+		}
+		return nil
+	}
+
+	s.Start(origin.Add(time.Second))
+	if err := s.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the latest event due at 2900 is sent again at once for its touch state
+	expect(t, c.sent, []sent{
+		{"1000", time.Second},
+		{"1500", 1500 * time.Millisecond},
+		{"2000", 1500 * time.Millisecond},
+		{"3000", 1600 * time.Millisecond},
+	})
+}
+
+func TestSeekBars(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		bars []time.Duration
+		n    int
+		want []sent
+	}{
+		{
+			// from 1000 in the first bar to the start of the second one at 1200
+			name: "forward",
+			bars: []time.Duration{0, 1200 * time.Millisecond, 2400 * time.Millisecond},
+			n:    1,
+			want: []sent{
+				{"1000", time.Second},
+				{"1000", time.Second},
+				{"1500", 1300 * time.Millisecond},
+				{"2000", 1800 * time.Millisecond},
+			},
+		},
+		{
+			// past the last bar
+			name: "clamped",
+			bars: []time.Duration{0, 1200 * time.Millisecond, 1800 * time.Millisecond},
+			n:    5,
+			want: []sent{
+				{"1000", time.Second},
+				{"1500", time.Second},
+				{"2000", 1200 * time.Millisecond},
+			},
+		},
+		{
+			// 2 seconds back from 1000 when the bars are unknown
+			name: "unknown",
+			n:    -1,
+			want: []sent{
+				{"1000", time.Second},
+				{"1000", 2 * time.Second},
+				{"1500", 2500 * time.Millisecond},
+				{"2000", 3 * time.Second},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := newClock()
+			c := &fakeController{clock: clock}
+			s := player.NewSession(c, clock)
+			s.Load(player.Chart{Bars: tc.bars}, events(1000, 1500, 2000))
+
+			c.onSend = func(i int) error {
+				if i == 0 {
+					if err := s.SeekBars(tc.n); err != nil {
+						t.Error(err)
+					}
+				}
+				return nil
+			}
+
+			s.Start(origin.Add(time.Second))
+			if err := s.Play(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			expect(t, c.sent, tc.want)
+		})
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	clock := newClock()
+	c := &reconnectingController{fakeController: fakeController{clock: clock}, down: 1200 * time.Millisecond}
+	s := newSession(c, clock, 1000, 1500, 2000, 2500, 3000)
+
+	disconnected := false
+	c.onSend = func(i int) error {
+		if i == 1 && !disconnected {
+			disconnected = true
+			return controllers.ErrDeviceDisconnected
+		}
+		return nil
+	}
+
+	s.Start(origin.Add(time.Second))
+	if err := s.Play(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// back at 2700, 2500 is the latest due
+	expect(t, c.sent, []sent{
+		{"1000", time.Second},
+		{"2500", 2700 * time.Millisecond},
+		{"3000", 3 * time.Second},
+	})
+}
+
+func TestNearestNote(t *testing.T) {
+	clock := newClock()
+	s := player.NewSession(&fakeController{clock: clock}, clock)
+	s.Load(player.Chart{Notes: []time.Duration{time.Second, 2 * time.Second}}, events(1000, 2000))
+	s.Start(origin.Add(time.Second))
+
+	for _, tc := range []struct {
+		at   time.Duration
+		note time.Duration
+		ok   bool
+	}{
+		{950 * time.Millisecond, time.Second, true},
+		{2040 * time.Millisecond, 2 * time.Second, true},
+		{1500 * time.Millisecond, 0, false},
+	} {
+		note, ok := s.NearestNote(origin.Add(tc.at))
+		if note != tc.note || ok != tc.ok {
+			t.Errorf("NearestNote(%v): got %v %v, want %v %v", tc.at, note, ok, tc.note, tc.ok)
+		}
+	}
+}
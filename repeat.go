@@ -0,0 +1,162 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kvarenzn/ssm/audio"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/log"
+	"github.com/kvarenzn/ssm/stage"
+	"github.com/kvarenzn/ssm/vision"
+)
+
+const (
+	screenTimeout = 90 * time.Second        // a screen that can not be passed, e.g. out of stamina
+	tapInterval   = 1500 * time.Millisecond // for the animation after a tap
+)
+
+var (
+	errScreenTimeout = errors.New("stuck on the same screen")
+	errNoTapTarget   = errors.New("tap target not defined")
+	errBuiltinSpec   = errors.New("the built-in screen states and tap targets are unmeasured placeholders, measure them from screenshots and put them in `screens.json` first")
+)
+
+// the button that leaves each screen, towards the next live
+var advanceTaps = map[vision.ScreenState]string{
+	vision.StateSelect:      vision.TapSelectStart,
+	vision.StateLiveSetting: vision.TapLiveStart,
+	vision.StateResult:      vision.TapResultNext,
+	vision.StateDialog:      vision.TapDialogOK,
+}
+
+// driver walks through the screens of the game for unattended repeat play
+type driver struct {
+	controller controllers.Controller
+	spec       *vision.ScreenSpec
+}
+
+func newDriver(controller controllers.Controller) (*driver, error) {
+	// guessed taps may hit the wrong buttons
+	spec := screenSpec()
+	if spec.Builtin() {
+		return nil, errBuiltinSpec
+	}
+
+	if _, err := waitFrame(controller); err != nil {
+		return nil, err
+	}
+
+	return &driver{
+		controller: controller,
+		spec:       spec,
+	}, nil
+}
+
+func (d *driver) tap(name string) error {
+	if _, ok := d.spec.Taps[name]; !ok {
+		return fmt.Errorf("%w: %s", errNoTapTarget, name)
+	}
+
+	return tap(d.controller, func(width, height float64) (float64, float64) {
+		x, y, _ := d.spec.Tap(name, width, height)
+		return x, y
+	})
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// advance taps through the screens until target is shown
+func (d *driver) advance(ctx context.Context, target vision.ScreenState) error {
+	last := vision.StateUnknown
+	since := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		frame, err := waitFrame(d.controller)
+		if err != nil {
+			return err
+		}
+
+		state := d.spec.Classify(frame.Image)
+		if state == target {
+			return nil
+		}
+
+		if state != last {
+			log.Debugf("Screen: %s", state)
+			last, since = state, time.Now()
+		} else if time.Since(since) > screenTimeout {
+			return fmt.Errorf("%w: %s", errScreenTimeout, state)
+		}
+
+		name, ok := advanceTaps[state]
+		if !ok {
+			// loading, playing or something unknown, nothing to do but wait
+			continue
+		}
+
+		if err := d.tap(name); err != nil {
+			return err
+		}
+
+		if err := sleepContext(ctx, tapInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// nextRound goes back to the song selection screen, and selects the next song if asked to
+func (t *tui) nextRound(ctx context.Context, d *driver, calc stage.LayoutCalculator) error {
+	if err := d.advance(ctx, vision.StateSelect); err != nil {
+		return err
+	}
+
+	if !nextSongMode {
+		return nil
+	}
+
+	if err := d.tap(vision.TapSelectNext); err != nil {
+		return err
+	}
+
+	if err := sleepContext(ctx, tapInterval); err != nil {
+		return err
+	}
+
+	songID = -1
+	if err := recognizeSelection(t.session.Controller(), t.db); err != nil {
+		return err
+	}
+
+	rawEvents, _, bars := loadTouchEvents()
+	events, err := t.session.Controller().Preprocess(rawEvents, calc)
+	if err != nil {
+		return err
+	}
+	notes := noteTimes(rawEvents)
+	t.session.Load(currentChart(notes, bars), events)
+	// the song audio given with `-x` is the one of the first song
+	t.reference = audio.ClickTrack(notes)
+	t.songReference = false
+
+	if err := t.loadJacket(); err != nil {
+		log.Debugln("Failed to load jacket:", err)
+	}
+	t.render(true)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is a monotonic clock that can sleep
+type Clock interface {
+	Now() time.Time
+	// Sleep sleeps for at least d, it may oversleep but never wakes up early unless ctx is done
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type systemClock struct{}
+
+// System is the clock of the system, its readings carry the monotonic clock
+var System Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// FakeClock is a clock for tests, time only passes when it is read, slept on or advanced
+type FakeClock struct {
+	Tick      time.Duration // passes on each reading, as reading a real clock takes time. Wait spins forever if it is 0
+	Oversleep time.Duration // added to each sleep, as a real timer wakes up late
+
+	mutex  sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// NewFakeClock returns a clock at start, 1µs passes on each reading
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{Tick: time.Microsecond, now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(c.Tick)
+	return c.now
+}
+
+func (c *FakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d + c.Oversleep)
+	return nil
+}
+
+// Advance lets d pass
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Sleeps returns the durations slept so far
+func (c *FakeClock) Sleeps() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]time.Duration{}, c.sleeps...)
+}
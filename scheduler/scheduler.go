@@ -0,0 +1,112 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+// Package scheduler fires events on time: it sleeps while the deadline is far,
+// then spins for the last moment, as timers may wake up a few milliseconds late.
+package scheduler
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSpin = 2 * time.Millisecond
+
+	// the deadline is read again at least this often, as it may move (e.g. offset changes)
+	maxSleep = 50 * time.Millisecond
+)
+
+type Scheduler struct {
+	clock Clock
+	Spin  time.Duration // spin instead of sleeping this long before the deadline
+
+	mutex    sync.Mutex
+	lateness []time.Duration
+}
+
+func New(clock Clock) *Scheduler {
+	return &Scheduler{
+		clock: clock,
+		Spin:  DefaultSpin,
+	}
+}
+
+func (s *Scheduler) Clock() Clock {
+	return s.clock
+}
+
+// Wait returns once the deadline is reached, deadline is called again after each sleep
+func (s *Scheduler) Wait(ctx context.Context, deadline func() time.Time) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		remaining := deadline().Sub(s.clock.Now())
+		if remaining <= 0 {
+			return nil
+		}
+
+		if remaining <= s.Spin {
+			runtime.Gosched()
+			continue
+		}
+
+		if err := s.clock.Sleep(ctx, min(remaining-s.Spin, maxSleep)); err != nil {
+			return err
+		}
+	}
+}
+
+// Record records how late an event with the deadline was, call it right after the event is fired
+func (s *Scheduler) Record(deadline time.Time) {
+	lateness := s.clock.Now().Sub(deadline)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lateness = append(s.lateness, lateness)
+}
+
+// Reset forgets the recorded lateness
+func (s *Scheduler) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lateness = s.lateness[:0]
+}
+
+// Stats summarizes the lateness of the recorded events
+type Stats struct {
+	Count int
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+func (s *Scheduler) Stats() Stats {
+	s.mutex.Lock()
+	sorted := slices.Clone(s.lateness)
+	s.mutex.Unlock()
+
+	if len(sorted) == 0 {
+		return Stats{}
+	}
+
+	slices.Sort(sorted)
+	return Stats{
+		Count: len(sorted),
+		P50:   percentile(sorted, 0.5),
+		P99:   percentile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
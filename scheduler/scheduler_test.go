@@ -0,0 +1,145 @@
+package scheduler_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvarenzn/ssm/scheduler"
+)
+
+var origin = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func fixed(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+func TestWaitSpins(t *testing.T) {
+	clock := scheduler.NewFakeClock(origin)
+	clock.Tick = 10 * time.Microsecond
+	clock.Oversleep = 1500 * time.Microsecond
+	s := scheduler.New(clock)
+
+	deadline := origin.Add(120 * time.Millisecond)
+	if err := s.Wait(context.Background(), fixed(deadline)); err != nil {
+		t.Fatal(err)
+	}
+	s.Record(deadline)
+
+	stats := s.Stats()
+	if stats.Count != 1 || stats.Max < 0 || stats.Max > 3*clock.Tick {
+		t.Errorf("Lateness: got %v, want at most %v", stats.Max, 3*clock.Tick)
+	}
+
+	for _, d := range clock.Sleeps() {
+		if d > 50*time.Millisecond {
+			t.Errorf("Slept %v at once, the deadline is not read again for that long", d)
+		}
+	}
+}
+
+func TestWaitOversleeps(t *testing.T) {
+	// without spinning, the lateness of the timer shows
+	clock := scheduler.NewFakeClock(origin)
+	clock.Tick = 0 // only the oversleep is measured, nothing spins
+	clock.Oversleep = 1500 * time.Microsecond
+	s := scheduler.New(clock)
+	s.Spin = 0
+
+	deadline := origin.Add(30 * time.Millisecond)
+	if err := s.Wait(context.Background(), fixed(deadline)); err != nil {
+		t.Fatal(err)
+	}
+	s.Record(deadline)
+
+	if stats := s.Stats(); stats.Max != clock.Oversleep {
+		t.Errorf("Lateness: got %v, want %v", stats.Max, clock.Oversleep)
+	}
+}
+
+func TestWaitMovingDeadline(t *testing.T) {
+	clock := scheduler.NewFakeClock(origin)
+	clock.Tick = 10 * time.Microsecond
+	s := scheduler.New(clock)
+
+	// the deadline is brought forward by 1 second after the first reading, e.g. by an offset change
+	deadline := origin.Add(2 * time.Second)
+	calls := 0
+	moving := func() time.Time {
+		calls++
+		if calls == 2 {
+			deadline = deadline.Add(-time.Second)
+		}
+		return deadline
+	}
+
+	if err := s.Wait(context.Background(), moving); err != nil {
+		t.Fatal(err)
+	}
+
+	if late := clock.Now().Sub(origin.Add(time.Second)); late < 0 || late > time.Millisecond {
+		t.Errorf("Returned %v after the moved deadline", late)
+	}
+}
+
+func TestWaitPast(t *testing.T) {
+	clock := scheduler.NewFakeClock(origin)
+	s := scheduler.New(clock)
+
+	if err := s.Wait(context.Background(), fixed(origin.Add(-time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.Sleeps()) != 0 {
+		t.Error("Slept for a deadline in the past")
+	}
+}
+
+func TestWaitSpinsWithDefaultTick(t *testing.T) {
+	// the deadline is within the spin window at once, time passes only by reading the clock
+	clock := scheduler.NewFakeClock(origin)
+	s := scheduler.New(clock)
+
+	deadline := origin.Add(s.Spin / 2)
+	if err := s.Wait(context.Background(), fixed(deadline)); err != nil {
+		t.Fatal(err)
+	}
+	if clock.Now().Before(deadline) {
+		t.Error("Returned before the deadline")
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	clock := scheduler.NewFakeClock(origin)
+	s := scheduler.New(clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Wait(ctx, fixed(origin.Add(time.Second))); err != context.Canceled {
+		t.Errorf("Got %v, want context.Canceled", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	clock := scheduler.NewFakeClock(origin)
+	clock.Tick = 0 // exact lateness
+	s := scheduler.New(clock)
+
+	if stats := s.Stats(); stats.Count != 0 {
+		t.Errorf("Stats of nothing: got %+v", stats)
+	}
+
+	// lateness of 100, 99, ..., 1 ms
+	for i := 1; i <= 100; i++ {
+		s.Record(clock.Now().Add(-time.Duration(101-i) * time.Millisecond))
+	}
+
+	want := scheduler.Stats{Count: 100, P50: 50 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}
+	if stats := s.Stats(); stats != want {
+		t.Errorf("Stats: got %+v, want %+v", stats, want)
+	}
+
+	s.Reset()
+	if stats := s.Stats(); stats.Count != 0 {
+		t.Errorf("Stats after reset: got %+v", stats)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package scores
+
+import "sort"
+
+// Bars are the start times of the bars (measures) of a chart, in seconds
+type Bars []float64
+
+// timing maps ticks to seconds the same way the parsers time the notes,
+// a tick is a bar number plus the fraction of the bar
+type timing []timingSegment
+
+// timingSegment takes effect on the tick `from`
+type timingSegment struct {
+	from       float64
+	tickStart  float64
+	secStart   float64
+	secPerTick float64
+}
+
+func (t *timing) set(from, tickStart, secStart, secPerTick float64) {
+	*t = append(*t, timingSegment{from, tickStart, secStart, secPerTick})
+}
+
+func (t timing) seconds(tick float64) float64 {
+	if len(t) == 0 {
+		return 0
+	}
+
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].from > tick
+	}) - 1
+	s := t[max(i, 0)]
+	return s.secStart + (tick-s.tickStart)*s.secPerTick
+}
+
+// bars returns the start of each bar up to the one containing the last tick
+func (t timing) bars(last float64) Bars {
+	bars := Bars{}
+	for bar := 0; float64(bar) <= last; bar++ {
+		bars = append(bars, t.seconds(float64(bar)))
+	}
+	return bars
+}
@@ -264,7 +264,8 @@ type bmsEventsPack struct {
 	RawEvents []*bmsRawEvent
 }
 
-func ParseBMS(chartText string) Chart {
+// ParseBMS parses a chart of the BanG Dream! game, the start times of its bars are returned as well
+func ParseBMS(chartText string) (Chart, Bars) {
 	const barLength = 4
 	const FIELD_BEGIN = "*----------------------"
 	const HEADER_BEGIN = "*---------------------- HEADER FIELD"
@@ -500,6 +501,8 @@ func ParseBMS(chartText string) Chart {
 	tickStart := 0.0
 
 	bpmEvents := []*bmsBPMEvent{}
+	var timing timing
+	timing.set(0, 0, 0, barLength*60/bpm)
 
 	for _, tick := range ticks {
 		pack := rawEvents[tick]
@@ -511,6 +514,7 @@ func ParseBMS(chartText string) Chart {
 			secStart += barLength * 60 / bpm * (tick - tickStart)
 			tickStart = tick
 			bpm = bpmValue
+			timing.set(tick, tickStart, secStart, barLength*60/bpm)
 		}
 
 		slices.SortFunc(pack.RawEvents, func(a, b *bmsRawEvent) int {
@@ -709,5 +713,9 @@ func ParseBMS(chartText string) Chart {
 		slideB = nil
 	}
 
-	return finalEvents
+	last := 0.0
+	if len(ticks) > 0 {
+		last = ticks[len(ticks)-1]
+	}
+	return finalEvents, timing.bars(last)
 }
@@ -81,12 +81,19 @@ func parseDataLine(line string) ([]*SimpleRawEvent, *SimpleRawEventCommon, error
 }
 
 type VTEGenerateConfig struct {
-	TapDuration         int64
-	FlickDuration       int64
-	FlickPow            float64
-	FlickFactor         float64
-	FlickReportInterval int64
-	SlideReportInterval int64
+	TapDuration         int64   `json:"tapDuration"`
+	FlickDuration       int64   `json:"flickDuration"`
+	FlickPow            float64 `json:"flickPow"`
+	FlickFactor         float64 `json:"flickFactor"`
+	FlickReportInterval int64   `json:"flickReportInterval"`
+	SlideReportInterval int64   `json:"slideReportInterval"`
+
+	// adaptive slide sampling, SlideReportInterval is used instead if SlideMaxError is 0
+	SlideMaxError    float64 `json:"slideMaxError,omitempty"`
+	SlideMinInterval int64   `json:"slideMinInterval,omitempty"`
+
+	// how far above the judge line contacts are placed, in judge line widths (see stage.Layout)
+	ContactDepth float64 `json:"contactDepth,omitempty"`
 }
 
 type noteKind uint8
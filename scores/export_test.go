@@ -0,0 +1,20 @@
+package scores
+
+// SlideSample exposes slideSample to the tests
+type SlideSample struct {
+	Ms    int64
+	Track float64
+}
+
+func SampleSlide(path []SlideSample, maxError float64, minInterval int64) []SlideSample {
+	samples := make([]slideSample, len(path))
+	for i, s := range path {
+		samples[i] = slideSample{s.Ms, s.Track}
+	}
+
+	result := []SlideSample{}
+	for _, s := range sampleSlide(samples, maxError, minInterval) {
+		result = append(result, SlideSample{s.ms, s.track})
+	}
+	return result
+}
@@ -412,14 +412,14 @@ func GenerateTouchEvent(config *VTEGenerateConfig, events []*star) common.RawVir
 			rate := factor * math.Pow(float64(i), config.FlickPow)
 			addEvent(i+ms, &common.VirtualTouchEvent{
 				X:         xs + dx*rate,
-				Y:         dy * rate,
+				Y:         config.ContactDepth + dy*rate,
 				Action:    common.TouchMove,
 				PointerID: pointerID,
 			})
 		}
 		addEvent(ms+config.FlickDuration+config.FlickReportInterval, &common.VirtualTouchEvent{
 			X:         xs + dx,
-			Y:         dy,
+			Y:         config.ContactDepth + dy,
 			Action:    common.TouchUp,
 			PointerID: pointerID,
 		})
@@ -431,13 +431,13 @@ func GenerateTouchEvent(config *VTEGenerateConfig, events []*star) common.RawVir
 			ms := quantify(event.seconds)
 			addEvent(ms, &common.VirtualTouchEvent{
 				X:         event.track,
-				Y:         0,
+				Y:         config.ContactDepth,
 				Action:    common.TouchDown,
 				PointerID: pointerID,
 			})
 			addEvent(ms+int64(config.TapDuration), &common.VirtualTouchEvent{
 				X:         event.track,
-				Y:         0,
+				Y:         config.ContactDepth,
 				Action:    common.TouchUp,
 				PointerID: pointerID,
 			})
@@ -445,13 +445,13 @@ func GenerateTouchEvent(config *VTEGenerateConfig, events []*star) common.RawVir
 			ms := quantify(event.seconds)
 			addEvent(ms, &common.VirtualTouchEvent{
 				X:         event.track,
-				Y:         0,
+				Y:         config.ContactDepth,
 				Action:    common.TouchDown,
 				PointerID: pointerID,
 			})
 			addEvent(ms+int64(config.TapDuration), &common.VirtualTouchEvent{
 				X:         event.track,
-				Y:         0,
+				Y:         config.ContactDepth,
 				Action:    common.TouchUp,
 				PointerID: pointerID,
 			})
@@ -459,7 +459,7 @@ func GenerateTouchEvent(config *VTEGenerateConfig, events []*star) common.RawVir
 			ms := quantify(event.seconds)
 			addEvent(ms, &common.VirtualTouchEvent{
 				X:         event.track,
-				Y:         0,
+				Y:         config.ContactDepth,
 				Action:    common.TouchDown,
 				PointerID: pointerID,
 			})
@@ -468,46 +468,75 @@ func GenerateTouchEvent(config *VTEGenerateConfig, events []*star) common.RawVir
 			var ms int64
 			var xStart float64
 
-			first := true
-			for step := range event.iterSlide() {
-				if first {
-					ms = quantify(step.seconds)
-					xStart = step.track
+			if config.SlideMaxError > 0 {
+				path := []slideSample{}
+				for step := range event.iterSlide() {
+					path = append(path, slideSample{quantify(step.seconds), step.track})
+				}
+				if len(path) == 0 {
+					// nothing to touch
+					continue
+				}
+
+				ms, xStart = path[0].ms, path[0].track
+				addEvent(ms, &common.VirtualTouchEvent{
+					X:         xStart,
+					Y:         config.ContactDepth,
+					Action:    common.TouchDown,
+					PointerID: pointerID,
+				})
+
+				for _, sample := range sampleSlide(path, config.SlideMaxError, config.SlideMinInterval) {
+					ms, xStart = sample.ms, sample.track
 					addEvent(ms, &common.VirtualTouchEvent{
-						X:         step.track,
-						Y:         0,
-						Action:    common.TouchDown,
+						X:         xStart,
+						Y:         config.ContactDepth,
+						Action:    common.TouchMove,
 						PointerID: pointerID,
 					})
-					first = false
-					continue
 				}
+			} else {
+				first := true
+				for step := range event.iterSlide() {
+					if first {
+						ms = quantify(step.seconds)
+						xStart = step.track
+						addEvent(ms, &common.VirtualTouchEvent{
+							X:         step.track,
+							Y:         config.ContactDepth,
+							Action:    common.TouchDown,
+							PointerID: pointerID,
+						})
+						first = false
+						continue
+					}
 
-				nextMs := quantify(step.seconds)
-				for i := ms + config.SlideReportInterval; i < nextMs; i += config.SlideReportInterval {
-					factor := float64(i-ms) / float64(nextMs-ms)
-					currentX := xStart + (step.track-xStart)*factor
-					addEvent(i, &common.VirtualTouchEvent{
-						X:         currentX,
-						Y:         0,
+					nextMs := quantify(step.seconds)
+					for i := ms + config.SlideReportInterval; i < nextMs; i += config.SlideReportInterval {
+						factor := float64(i-ms) / float64(nextMs-ms)
+						currentX := xStart + (step.track-xStart)*factor
+						addEvent(i, &common.VirtualTouchEvent{
+							X:         currentX,
+							Y:         config.ContactDepth,
+							Action:    common.TouchMove,
+							PointerID: pointerID,
+						})
+					}
+					ms = nextMs
+					xStart = step.track
+					addEvent(ms, &common.VirtualTouchEvent{
+						X:         step.track,
+						Y:         config.ContactDepth,
 						Action:    common.TouchMove,
 						PointerID: pointerID,
 					})
 				}
-				ms = nextMs
-				xStart = step.track
-				addEvent(ms, &common.VirtualTouchEvent{
-					X:         step.track,
-					Y:         0,
-					Action:    common.TouchMove,
-					PointerID: pointerID,
-				})
 			}
 
 			if !event.isFlick() {
 				addEvent(ms+1, &common.VirtualTouchEvent{
 					X:         xStart,
-					Y:         0,
+					Y:         config.ContactDepth,
 					Action:    common.TouchUp,
 					PointerID: pointerID,
 				})
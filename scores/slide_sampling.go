@@ -0,0 +1,71 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package scores
+
+import "math"
+
+type slideSample struct {
+	ms    int64
+	track float64
+}
+
+func slideSlope(a, b slideSample) float64 {
+	if a.ms == b.ms {
+		return math.Copysign(math.Inf(1), b.track-a.track)
+	}
+
+	return (b.track - a.track) / float64(b.ms-a.ms)
+}
+
+// isSharpBend reports whether the path turns around (or starts/stops moving) at b
+func isSharpBend(a, b, c slideSample) bool {
+	s1, s2 := slideSlope(a, b), slideSlope(b, c)
+	return s1*s2 < 0 || (s1 == 0) != (s2 == 0)
+}
+
+// sampleSlide picks the moments at which a slide pointer has to be reported.
+//
+// The device keeps the pointer where it was last reported, so a new move is
+// emitted as soon as the path drifts more than maxError away from it, but
+// never sooner than minInterval after the previous one. Vertices where the
+// path bends sharply are always emitted, and so is the last vertex.
+// path[0] is the touch down position and is not part of the result.
+func sampleSlide(path []slideSample, maxError float64, minInterval int64) []slideSample {
+	result := []slideSample{}
+	if len(path) < 2 {
+		return result
+	}
+
+	last := path[0]
+	emit := func(s slideSample) {
+		result = append(result, s)
+		last = s
+	}
+
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		for t := a.ms + 1; t < b.ms; t++ {
+			if t-last.ms < minInterval {
+				continue
+			}
+
+			x := a.track + (b.track-a.track)*float64(t-a.ms)/float64(b.ms-a.ms)
+			if math.Abs(x-last.track) >= maxError {
+				emit(slideSample{t, x})
+			}
+		}
+
+		if i == len(path)-1 {
+			emit(b)
+		} else if b.track == last.track {
+			continue
+		} else if isSharpBend(a, b, path[i+1]) {
+			emit(b)
+		} else if b.ms-last.ms >= minInterval && math.Abs(b.track-last.track) >= maxError {
+			emit(b)
+		}
+	}
+
+	return result
+}
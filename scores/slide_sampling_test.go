@@ -0,0 +1,77 @@
+package scores_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kvarenzn/ssm/scores"
+)
+
+type sample = scores.SlideSample
+
+// trackAt interpolates the path at ms
+func trackAt(path []sample, ms int64) float64 {
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		if ms <= b.Ms {
+			return a.Track + (b.Track-a.Track)*float64(ms-a.Ms)/float64(b.Ms-a.Ms)
+		}
+	}
+	return path[len(path)-1].Track
+}
+
+func TestSampleSlide(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		path        []sample
+		maxError    float64
+		minInterval int64
+		bends       bool // sharp bends are emitted regardless of minInterval
+	}{
+		{name: "straight", path: []sample{{0, 0}, {1000, 1}}, maxError: 0.05},
+		{name: "fast", path: []sample{{0, 0}, {100, 1}}, maxError: 0.01, minInterval: 16},
+		{name: "slow", path: []sample{{0, 0.2}, {2000, 0.3}}, maxError: 0.04, minInterval: 16},
+		{name: "curve", path: []sample{{0, 0}, {200, 0.3}, {400, 0.5}, {600, 0.6}, {800, 0.65}}, maxError: 0.02, minInterval: 10},
+		{name: "zigzag", path: []sample{{0, 0}, {300, 0.6}, {310, 0.1}, {700, 0.9}}, maxError: 0.05, minInterval: 50, bends: true},
+		{name: "still", path: []sample{{0, 0.5}, {1000, 0.5}}, maxError: 0.01, minInterval: 16},
+		{name: "within error", path: []sample{{0, 0.5}, {500, 0.51}, {1000, 0.52}}, maxError: 0.05, minInterval: 16},
+		{name: "single", path: []sample{{0, 0.5}}, maxError: 0.01},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := scores.SampleSlide(tc.path, tc.maxError, tc.minInterval)
+			if len(tc.path) < 2 {
+				if len(result) != 0 {
+					t.Errorf("Got %v from a path without moves", result)
+				}
+				return
+			}
+
+			// the last point is always kept
+			end := tc.path[len(tc.path)-1]
+			if len(result) == 0 || result[len(result)-1] != end {
+				t.Fatalf("Got %v, want the last point %v at the end", result, end)
+			}
+
+			held := tc.path[0]
+			next := 0
+			for ms := tc.path[0].Ms; ms <= end.Ms; ms++ {
+				if next < len(result) && result[next].Ms == ms {
+					if !tc.bends && next < len(result)-1 && ms-held.Ms < tc.minInterval {
+						t.Errorf("Moved at %d ms, only %d ms after %d ms", ms, ms-held.Ms, held.Ms)
+					}
+					held = result[next]
+					next++
+				}
+
+				// the pointer only drifts away farther than maxError when it may not move yet
+				if drift := math.Abs(trackAt(tc.path, ms) - held.Track); drift > tc.maxError && ms-held.Ms >= tc.minInterval {
+					t.Errorf("At %d ms the path is %.3f away from the pointer at %.3f", ms, drift, held.Track)
+				}
+			}
+
+			if next != len(result) {
+				t.Errorf("Got %v, the samples are not in order", result)
+			}
+		})
+	}
+}
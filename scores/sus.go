@@ -105,7 +105,8 @@ func polylineX(list []*vec2f, y float64) float64 {
 	return list[len(list)-1].x
 }
 
-func ParseSUS(chartText string) (Chart, error) {
+// ParseSUS parses a chart of the Project SEKAI game, the start times of its bars are returned as well
+func ParseSUS(chartText string) (Chart, Bars, error) {
 	bpms := map[string]float64{}
 
 	collectedEvents := map[float64]*susEventsPack{}
@@ -153,7 +154,7 @@ func ParseSUS(chartText string) (Chart, error) {
 				value = strings.TrimSpace(value)
 				i, err := strconv.ParseInt(value, 10, 64)
 				if err != nil {
-					return nil, fmt.Errorf("Failed to parse ticks_per_beat: %s", err)
+					return nil, nil, fmt.Errorf("Failed to parse ticks_per_beat: %s", err)
 				}
 
 				_ = int(i)
@@ -168,7 +169,7 @@ func ParseSUS(chartText string) (Chart, error) {
 
 				bpm, err := strconv.ParseFloat(value, 64)
 				if err != nil {
-					return nil, fmt.Errorf("Failed to parse BPM list item value `%s`: %s", value, err)
+					return nil, nil, fmt.Errorf("Failed to parse BPM list item value `%s`: %s", value, err)
 				}
 
 				bpms[index] = bpm
@@ -176,12 +177,12 @@ func ParseSUS(chartText string) (Chart, error) {
 			} else if len(key) == 5 && strings.HasSuffix(key, "02") {
 				index, err := strconv.ParseInt(key[:3], 10, 64)
 				if err != nil {
-					return nil, fmt.Errorf("Failed to parse time signature list item key `%s`: %s", key, err)
+					return nil, nil, fmt.Errorf("Failed to parse time signature list item key `%s`: %s", key, err)
 				}
 
 				sig, err := strconv.ParseFloat(value, 64)
 				if err != nil {
-					return nil, fmt.Errorf("Failed to parse time signature list item value `%s`: %s", value, err)
+					return nil, nil, fmt.Errorf("Failed to parse time signature list item value `%s`: %s", value, err)
 				}
 
 				tick := float64(index)
@@ -195,13 +196,13 @@ func ParseSUS(chartText string) (Chart, error) {
 
 			events, common, err := parseDataLine(line)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			if common.Channel == "08" {
 				for _, ev := range events {
 					if bpm, ok := bpms[ev.Type]; !ok {
-						return nil, fmt.Errorf("Invalid BPM index `%s`", ev.Type)
+						return nil, nil, fmt.Errorf("Invalid BPM index `%s`", ev.Type)
 					} else {
 						tick := ev.Tick()
 						if _, ok := collectedEvents[tick]; !ok {
@@ -209,7 +210,7 @@ func ParseSUS(chartText string) (Chart, error) {
 						}
 
 						if collectedEvents[tick].bpm != 0.0 {
-							return nil, fmt.Errorf("Duplicated BPM event at tick %f", tick)
+							return nil, nil, fmt.Errorf("Duplicated BPM event at tick %f", tick)
 						}
 
 						collectedEvents[tick].bpm = bpm
@@ -220,7 +221,7 @@ func ParseSUS(chartText string) (Chart, error) {
 
 			laneID, err := hexToInt(common.Channel[1])
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			if laneID < 2 || laneID > 13 {
@@ -241,7 +242,7 @@ func ParseSUS(chartText string) (Chart, error) {
 
 				width, err := hexToInt(event.Type[1])
 				if err != nil {
-					return nil, fmt.Errorf("Unknown width char: %s", string(event.Type[1]))
+					return nil, nil, fmt.Errorf("Unknown width char: %s", string(event.Type[1]))
 				}
 
 				note := &susRawNoteEvent{
@@ -264,7 +265,7 @@ func ParseSUS(chartText string) (Chart, error) {
 				case '9': // decorated slides
 					p.trails = append(p.trails, note)
 				default:
-					return nil, fmt.Errorf("Unknown type: %s", string(rune(common.Channel[0])))
+					return nil, nil, fmt.Errorf("Unknown type: %s", string(rune(common.Channel[0])))
 				}
 			}
 		}
@@ -339,6 +340,8 @@ func ParseSUS(chartText string) (Chart, error) {
 	bpm := 120.0
 	finalEvents := []*star{}
 	barLength := 4.0
+	var timing timing
+	timing.set(0, 0, 0, barLength*60/bpm)
 	for _, tick := range ticks {
 		pack := collectedEvents[tick]
 
@@ -353,6 +356,10 @@ func ParseSUS(chartText string) (Chart, error) {
 			barLength = pack.barLength
 		}
 
+		if pack.bpm != 0.0 || pack.barLength != 0.0 {
+			timing.set(tick, tickStart, secStart, barLength*60/bpm)
+		}
+
 		secPerTick := barLength * 60 / bpm
 		secs := secStart + (tick-tickStart)*secPerTick
 
@@ -380,7 +387,7 @@ func ParseSUS(chartText string) (Chart, error) {
 				}
 
 				if _, ok := slides[n.identifier]; ok {
-					return nil, fmt.Errorf("Duplicated slide begin with same identifier: %s", string(n.identifier))
+					return nil, nil, fmt.Errorf("Duplicated slide begin with same identifier: %s", string(n.identifier))
 				}
 
 				slides[n.identifier] = newStar(
@@ -413,7 +420,7 @@ func ParseSUS(chartText string) (Chart, error) {
 				}
 
 				if _, ok := slides[n.identifier]; !ok {
-					return nil, fmt.Errorf("Slide begin with identifier %s not found", string(n.identifier))
+					return nil, nil, fmt.Errorf("Slide begin with identifier %s not found", string(n.identifier))
 				}
 
 				chainSlide(
@@ -449,7 +456,7 @@ func ParseSUS(chartText string) (Chart, error) {
 				}
 
 				if _, ok := slides[n.identifier]; !ok {
-					return nil, fmt.Errorf("Slide begin with identifier %s not found", string(n.identifier))
+					return nil, nil, fmt.Errorf("Slide begin with identifier %s not found", string(n.identifier))
 				}
 
 				chainSlide(
@@ -485,7 +492,7 @@ func ParseSUS(chartText string) (Chart, error) {
 				}
 
 				if _, ok := slides[n.identifier]; !ok {
-					return nil, fmt.Errorf("Slide begin with identifier %s not found", string(n.identifier))
+					return nil, nil, fmt.Errorf("Slide begin with identifier %s not found", string(n.identifier))
 				}
 
 				if !ignorePosition {
@@ -555,5 +562,9 @@ func ParseSUS(chartText string) (Chart, error) {
 		}
 	}
 
-	return finalEvents, nil
+	last := 0.0
+	if len(ticks) > 0 {
+		last = ticks[len(ticks)-1]
+	}
+	return finalEvents, timing.bars(last), nil
 }
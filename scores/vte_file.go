@@ -0,0 +1,379 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package scores
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kvarenzn/ssm/common"
+)
+
+// Virtual touch event files, see docs/EVENTS.md for the format.
+
+const (
+	VTEFormat      = "ssm-vte"
+	VTEFileVersion = 1
+
+	// binary variant
+	vteMagic = "SSMV"
+
+	// the controllers keep track of 10 fingers at most
+	MaxPointers = 10
+)
+
+var (
+	ErrNotVTEFile  = errors.New("not a touch event file")
+	ErrVTEVersion  = errors.New("unsupported touch event file version")
+	ErrVTEChecksum = errors.New("touch event file checksum mismatch")
+)
+
+type VTEChartInfo struct {
+	Path       string `json:"path,omitempty"`
+	SongID     int    `json:"songId,omitempty"`
+	Difficulty string `json:"difficulty,omitempty"`
+	Mode       string `json:"mode,omitempty"` // `bang` or `pjsk`
+}
+
+type VTEFile struct {
+	Format   string                  `json:"format"`
+	Version  int                     `json:"version"`
+	Chart    VTEChartInfo            `json:"chart"`
+	Profile  *VTEGenerateConfig      `json:"profile,omitempty"`
+	Checksum string                  `json:"checksum,omitempty"`
+	Events   common.RawVirtualEvents `json:"events"`
+}
+
+func NewVTEFile(chart VTEChartInfo, profile *VTEGenerateConfig, events common.RawVirtualEvents) *VTEFile {
+	return &VTEFile{
+		Format:   VTEFormat,
+		Version:  VTEFileVersion,
+		Chart:    chart,
+		Profile:  profile,
+		Checksum: EventsChecksum(events),
+		Events:   events,
+	}
+}
+
+// encodeEvents writes the canonical binary form of events.
+// The checksum of both variants is calculated over this form.
+func encodeEvents(w *bytes.Buffer, events common.RawVirtualEvents) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) {
+		w.Write(buf[:binary.PutUvarint(buf, v)])
+	}
+	putVarint := func(v int64) {
+		w.Write(buf[:binary.PutVarint(buf, v)])
+	}
+	putFloat := func(f float64) {
+		binary.BigEndian.PutUint64(buf, math.Float64bits(f))
+		w.Write(buf[:8])
+	}
+
+	putUvarint(uint64(len(events)))
+	var last int64
+	for _, item := range events {
+		putVarint(item.Timestamp - last)
+		last = item.Timestamp
+		putUvarint(uint64(len(item.Events)))
+		for _, ev := range item.Events {
+			putUvarint(uint64(ev.PointerID))
+			w.WriteByte(byte(ev.Action))
+			putFloat(ev.X)
+			putFloat(ev.Y)
+		}
+	}
+}
+
+func decodeEvents(r *bytes.Reader) (common.RawVirtualEvents, error) {
+	buf := make([]byte, 8)
+	getFloat := func() (float64, error) {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := common.RawVirtualEvents{}
+	var last int64
+	for range count {
+		delta, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		last += delta
+
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+
+		item := &common.VirtualEventsItem{Timestamp: last}
+		for range n {
+			id, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+
+			action, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+
+			x, err := getFloat()
+			if err != nil {
+				return nil, err
+			}
+
+			y, err := getFloat()
+			if err != nil {
+				return nil, err
+			}
+
+			item.Events = append(item.Events, &common.VirtualTouchEvent{
+				PointerID: int(id),
+				Action:    common.TouchAction(action),
+				X:         x,
+				Y:         y,
+			})
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+func checksumOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func EventsChecksum(events common.RawVirtualEvents) string {
+	body := &bytes.Buffer{}
+	encodeEvents(body, events)
+	return checksumOf(body.Bytes())
+}
+
+// ValidateEvents checks that timestamps never go backwards and every pointer
+// follows the down -> move* -> up lifecycle.
+func ValidateEvents(events common.RawVirtualEvents) error {
+	onScreen := make([]bool, MaxPointers)
+	var last int64
+	for i, item := range events {
+		if i > 0 && item.Timestamp < last {
+			return fmt.Errorf("%w: timestamp %d goes backwards", common.ErrInvalidEventStream, item.Timestamp)
+		}
+		last = item.Timestamp
+
+		for _, ev := range item.Events {
+			if ev.PointerID < 0 || ev.PointerID >= MaxPointers {
+				return fmt.Errorf("%w: pointer id %d out of range at %d ms", common.ErrInvalidEventStream, ev.PointerID, item.Timestamp)
+			}
+
+			switch ev.Action {
+			case common.TouchDown:
+				if onScreen[ev.PointerID] {
+					return fmt.Errorf("%w: pointer `%d` is already on screen at %d ms", common.ErrInvalidEventStream, ev.PointerID, item.Timestamp)
+				}
+				onScreen[ev.PointerID] = true
+			case common.TouchMove:
+				if !onScreen[ev.PointerID] {
+					return fmt.Errorf("%w: pointer `%d` is not on screen at %d ms", common.ErrInvalidEventStream, ev.PointerID, item.Timestamp)
+				}
+			case common.TouchUp:
+				if !onScreen[ev.PointerID] {
+					return fmt.Errorf("%w: pointer `%d` is not on screen at %d ms", common.ErrInvalidEventStream, ev.PointerID, item.Timestamp)
+				}
+				onScreen[ev.PointerID] = false
+			default:
+				return fmt.Errorf("%w: unknown touch action %d at %d ms", common.ErrInvalidEventStream, ev.Action, item.Timestamp)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *VTEFile) EncodeJSON() ([]byte, error) {
+	return json.MarshalIndent(f, "", "\t")
+}
+
+// EncodeBinary encodes f as:
+//
+//	magic "SSMV" | version u16 | header length u32 | header (json, without events)
+//	| body length u32 | body | sha256(body) [32]byte
+func (f *VTEFile) EncodeBinary() ([]byte, error) {
+	header, err := json.Marshal(&VTEFile{
+		Format:  f.Format,
+		Version: f.Version,
+		Chart:   f.Chart,
+		Profile: f.Profile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	encodeEvents(body, f.Events)
+
+	out := &bytes.Buffer{}
+	out.WriteString(vteMagic)
+	binary.Write(out, binary.BigEndian, uint16(f.Version))
+	binary.Write(out, binary.BigEndian, uint32(len(header)))
+	out.Write(header)
+	binary.Write(out, binary.BigEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	sum := sha256.Sum256(body.Bytes())
+	out.Write(sum[:])
+	return out.Bytes(), nil
+}
+
+func decodeBinaryVTEFile(data []byte) (*VTEFile, error) {
+	r := bytes.NewReader(data[len(vteMagic):])
+
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != VTEFileVersion {
+		return nil, fmt.Errorf("%w: %d", ErrVTEVersion, version)
+	}
+
+	readChunk := func() ([]byte, error) {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		return chunk, nil
+	}
+
+	header, err := readChunk()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &VTEFile{}
+	if err := json.Unmarshal(header, f); err != nil {
+		return nil, err
+	}
+
+	body, err := readChunk()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, sum); err != nil {
+		return nil, err
+	}
+
+	f.Checksum = "sha256:" + hex.EncodeToString(sum)
+	if checksumOf(body) != f.Checksum {
+		return nil, ErrVTEChecksum
+	}
+
+	f.Events, err = decodeEvents(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	f.Version = int(version)
+	return f, nil
+}
+
+func decodeJSONVTEFile(data []byte) (*VTEFile, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, ErrNotVTEFile
+	}
+
+	// bare event list, as dumped to `res.json`
+	if trimmed[0] == '[' {
+		f := &VTEFile{}
+		if err := json.Unmarshal(trimmed, &f.Events); err != nil {
+			return nil, ErrNotVTEFile
+		}
+		f.Format = VTEFormat
+		return f, nil
+	}
+
+	if trimmed[0] != '{' {
+		return nil, ErrNotVTEFile
+	}
+
+	f := &VTEFile{}
+	if err := json.Unmarshal(trimmed, f); err != nil || f.Format != VTEFormat {
+		return nil, ErrNotVTEFile
+	}
+
+	if f.Version != VTEFileVersion {
+		return nil, fmt.Errorf("%w: %d", ErrVTEVersion, f.Version)
+	}
+
+	// hand-edited files may drop the checksum
+	if f.Checksum != "" && EventsChecksum(f.Events) != f.Checksum {
+		return nil, ErrVTEChecksum
+	}
+
+	return f, nil
+}
+
+// DecodeVTEFile decodes either variant of a touch event file.
+// ErrNotVTEFile is returned if data looks like something else (a chart, for instance).
+func DecodeVTEFile(data []byte) (*VTEFile, error) {
+	var f *VTEFile
+	var err error
+	if bytes.HasPrefix(data, []byte(vteMagic)) {
+		f, err = decodeBinaryVTEFile(data)
+	} else {
+		f, err = decodeJSONVTEFile(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateEvents(f.Events); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Save writes f to path. Files ending with `.vte` are written in the binary variant, others in JSON.
+func (f *VTEFile) Save(path string) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".vte") {
+		data, err = f.EncodeBinary()
+	} else {
+		data, err = f.EncodeJSON()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,167 @@
+package scores_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/scores"
+)
+
+func touch(id int, action common.TouchAction, x, y float64) *common.VirtualTouchEvent {
+	return &common.VirtualTouchEvent{PointerID: id, Action: action, X: x, Y: y}
+}
+
+// a tap, and a slide held by another finger meanwhile
+var vteEvents = common.RawVirtualEvents{
+	{Timestamp: 1000, Events: []*common.VirtualTouchEvent{touch(0, common.TouchDown, 0.25, 0), touch(1, common.TouchDown, 0.5, 0)}},
+	{Timestamp: 1020, Events: []*common.VirtualTouchEvent{touch(0, common.TouchUp, 0.25, 0)}},
+	{Timestamp: 1500, Events: []*common.VirtualTouchEvent{touch(1, common.TouchMove, 0.625, 0.01)}},
+	{Timestamp: 2000, Events: []*common.VirtualTouchEvent{touch(1, common.TouchUp, 0.75, 0)}},
+}
+
+func newVTEFile() *scores.VTEFile {
+	return scores.NewVTEFile(scores.VTEChartInfo{SongID: 42, Difficulty: "expert", Mode: "bang"}, nil, vteEvents)
+}
+
+func TestVTERoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		encode func(f *scores.VTEFile) ([]byte, error)
+	}{
+		{"json", (*scores.VTEFile).EncodeJSON},
+		{"binary", (*scores.VTEFile).EncodeBinary},
+		{"bare", func(f *scores.VTEFile) ([]byte, error) { return json.Marshal(f.Events) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newVTEFile()
+			data, err := tc.encode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := bytes.HasPrefix(data, []byte("SSMV")); got != (tc.name == "binary") {
+				t.Errorf("Starts with the magic: %v", got)
+			}
+
+			decoded, err := scores.DecodeVTEFile(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(decoded.Events, vteEvents) {
+				t.Errorf("Events: got %v, want %v", decoded.Events, vteEvents)
+			}
+
+			if decoded.Format != scores.VTEFormat {
+				t.Errorf("Format: got %q", decoded.Format)
+			}
+
+			// a bare event list carries nothing else
+			if tc.name == "bare" {
+				return
+			}
+
+			if decoded.Chart != f.Chart || decoded.Version != scores.VTEFileVersion {
+				t.Errorf("Header: got %+v version %d, want %+v version %d", decoded.Chart, decoded.Version, f.Chart, scores.VTEFileVersion)
+			}
+
+			if decoded.Checksum != scores.EventsChecksum(vteEvents) {
+				t.Errorf("Checksum: got %s, want %s", decoded.Checksum, scores.EventsChecksum(vteEvents))
+			}
+		})
+	}
+}
+
+func TestVTEChecksumMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		encode func(f *scores.VTEFile) ([]byte, error)
+	}{
+		{"json", func(f *scores.VTEFile) ([]byte, error) {
+			// an event is edited after the checksum is calculated
+			f.Events = append(f.Events[:len(f.Events)-1:len(f.Events)-1], &common.VirtualEventsItem{
+				Timestamp: 2100,
+				Events:    []*common.VirtualTouchEvent{touch(1, common.TouchUp, 0.75, 0)},
+			})
+			return f.EncodeJSON()
+		}},
+		{"binary", func(f *scores.VTEFile) ([]byte, error) {
+			data, err := f.EncodeBinary()
+			if err != nil {
+				return nil, err
+			}
+
+			// the last byte belongs to the checksum
+			data[len(data)-1] ^= 0xff
+			return data, nil
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.encode(newVTEFile())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := scores.DecodeVTEFile(data); !errors.Is(err, scores.ErrVTEChecksum) {
+				t.Errorf("Got %v, want ErrVTEChecksum", err)
+			}
+		})
+	}
+}
+
+func TestValidateEvents(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		events common.RawVirtualEvents
+		valid  bool
+	}{
+		{"valid", vteEvents, true},
+		{
+			name: "duplicate down",
+			events: common.RawVirtualEvents{
+				{Timestamp: 0, Events: []*common.VirtualTouchEvent{touch(0, common.TouchDown, 0.5, 0)}},
+				{Timestamp: 100, Events: []*common.VirtualTouchEvent{touch(0, common.TouchDown, 0.5, 0)}},
+			},
+		},
+		{
+			name: "up without down",
+			events: common.RawVirtualEvents{
+				{Timestamp: 0, Events: []*common.VirtualTouchEvent{touch(0, common.TouchDown, 0.5, 0)}},
+				{Timestamp: 100, Events: []*common.VirtualTouchEvent{touch(1, common.TouchUp, 0.5, 0)}},
+			},
+		},
+		{
+			name: "move without down",
+			events: common.RawVirtualEvents{
+				{Timestamp: 0, Events: []*common.VirtualTouchEvent{touch(0, common.TouchMove, 0.5, 0)}},
+			},
+		},
+		{
+			name: "backwards",
+			events: common.RawVirtualEvents{
+				{Timestamp: 100, Events: []*common.VirtualTouchEvent{touch(0, common.TouchDown, 0.5, 0)}},
+				{Timestamp: 50, Events: []*common.VirtualTouchEvent{touch(0, common.TouchUp, 0.5, 0)}},
+			},
+		},
+		{
+			name: "pointer out of range",
+			events: common.RawVirtualEvents{
+				{Timestamp: 0, Events: []*common.VirtualTouchEvent{touch(scores.MaxPointers, common.TouchDown, 0.5, 0)}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := scores.ValidateEvents(tc.events)
+			if tc.valid && err != nil {
+				t.Errorf("Got %v, want no error", err)
+			}
+			if !tc.valid && !errors.Is(err, common.ErrInvalidEventStream) {
+				t.Errorf("Got %v, want ErrInvalidEventStream", err)
+			}
+		})
+	}
+}
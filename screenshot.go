@@ -0,0 +1,80 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"image/png"
+	"os"
+	"time"
+
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/decoders/av"
+	"github.com/kvarenzn/ssm/log"
+)
+
+const screenshotTimeout = 10 * time.Second
+
+var (
+	errNoVideoFrame = errors.New("no video frame received from the device")
+	errNoVideo      = errors.New("the video stream is only available with the `adb` backend, and without the `noVideo` option")
+)
+
+// waitFrame returns the next frame of the screen, only the `adb` backend has the video stream
+func waitFrame(controller controllers.Controller) (*av.Frame, error) {
+	sc, ok := controller.(*controllers.ScrcpyController)
+	if !ok || !sc.HasVideo() {
+		return nil, errNoVideo
+	}
+
+	var frame *av.Frame
+	select {
+	case frame = <-sc.Frames():
+	case <-time.After(screenshotTimeout):
+	}
+	if frame == nil {
+		return nil, errNoVideoFrame
+	}
+	return frame, nil
+}
+
+// screenshot saves the screen of the device as a PNG file, through the video stream of scrcpy,
+// so it needs `-b adb`
+func screenshot(conf *config.Config, path string) error {
+	if backend != "adb" {
+		return errNoVideo
+	}
+
+	if path == "" {
+		path = "screenshot.png"
+	}
+
+	scrcpyOptions := scrcpyOptionsOf(conf)
+	scrcpyOptions.NoVideo = false
+	scrcpyOptions.AudioSource = ""
+
+	controller, _ := connect(conf, controllers.Options{
+		Scrcpy: scrcpyOptions,
+	})
+	defer controller.Close()
+
+	frame, err := waitFrame(controller)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, frame.RGBA(nil)); err != nil {
+		return err
+	}
+
+	log.Infoln("Screenshot saved to", path)
+	return nil
+}
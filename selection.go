@@ -0,0 +1,110 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/db"
+	"github.com/kvarenzn/ssm/log"
+	"github.com/kvarenzn/ssm/vision"
+)
+
+var errNoJackets = errors.New("no jacket extracted, please extract the assets with `-e` first")
+
+// selectionMissing reports whether the song or the difficulty has to be read from the song selection screen
+func selectionMissing() bool {
+	return chartPath == "" && (songID == -1 || difficulty == "")
+}
+
+func gameName() string {
+	if pjskMode {
+		return "pjsk"
+	}
+	return "bang"
+}
+
+// screenSpec returns the screen spec of the stage layout, custom layouts fall back to the spec of the game
+func screenSpec() *vision.ScreenSpec {
+	if spec, ok := vision.Get(getLayoutName()); ok {
+		return spec
+	}
+
+	spec, ok := vision.Get(gameName())
+	if !ok {
+		log.Dief("Unknown screen spec: %q", gameName())
+	}
+	return spec
+}
+
+// loadJacketIndex loads the cached jacket hashes, and hashes the newly extracted jackets
+func loadJacketIndex(database db.MusicDatabase) *vision.JacketIndex {
+	path := "./jackets-" + gameName() + ".json"
+
+	index, err := vision.LoadJacketIndex(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("Failed to load jacket index:", err)
+		}
+		index = vision.NewJacketIndex()
+	}
+
+	if database == nil {
+		return index
+	}
+
+	if added := index.Update(database); added > 0 {
+		log.Infof("%d jackets indexed.", added)
+		if err := index.Save(path); err != nil {
+			log.Warn("Failed to save jacket index:", err)
+		}
+	}
+
+	return index
+}
+
+// recognizeSelection fills the song ID and the difficulty not given in the flags from the screen of the device
+func recognizeSelection(controller controllers.Controller, database db.MusicDatabase) error {
+	spec := screenSpec()
+	if spec.Builtin() {
+		log.Warn("Song recognition is experimental, the built-in jacket and badge regions are unmeasured. Check the recognized song before playing")
+	}
+
+	frame, err := waitFrame(controller)
+	if err != nil {
+		return err
+	}
+	screen := frame.RGBA(nil)
+
+	if songID == -1 {
+		index := loadJacketIndex(database)
+		if index.Len() == 0 {
+			return errNoJackets
+		}
+
+		id, distance, ok := spec.MatchJacket(screen, index)
+		if !ok {
+			return vision.ErrJacketNotFound
+		}
+		log.Debugf("Jacket matched: song %d, distance %d", id, distance)
+		songID = id
+	}
+
+	if difficulty == "" {
+		d, ok := spec.ClassifyDifficulty(screen)
+		if !ok {
+			return vision.ErrDifficultyNotFound
+		}
+		difficulty = d
+	}
+
+	title := ""
+	if database != nil {
+		title = database.Title(songID, "${title}")
+	}
+	log.Infof("Recognized song %d %s (%s)", songID, title, difficulty)
+	return nil
+}
@@ -3,4 +3,58 @@
 
 package stage
 
-type JudgeLinePositionCalculator func(width, height float64) (float64, float64, float64)
+import "math"
+
+// Layout describes the stage on a landscape screen, in pixels.
+//
+// Stage coordinates are (lane, depth): lane 0 and 1 are the centers of the
+// leftmost and rightmost lanes, depth 0 is the judge line and positive depth
+// goes up the lanes. Both are measured in judge line widths, so a small step
+// near the judge line has the same length on screen in either direction.
+type Layout struct {
+	Left    float64 // x of lane 0 on the judge line
+	Right   float64 // x of lane 1 on the judge line
+	JudgeY  float64 // y of the judge line
+	VanishY float64 // y of the point where the lanes converge, -Inf for a flat stage
+}
+
+type LayoutCalculator func(width, height float64) *Layout
+
+// Project maps a point on the stage to screen pixels.
+func (l *Layout) Project(lane, depth float64) (float64, float64) {
+	w := l.Right - l.Left
+	x := l.Left + w*lane
+	if math.IsInf(l.VanishY, -1) {
+		return x, l.JudgeY - w*depth
+	}
+
+	// perspective division, scaled so that dy/ddepth = -w at the judge line
+	h := l.JudgeY - l.VanishY
+	s := h / max(h+w*depth, 1e-6)
+	middle := (l.Left + l.Right) / 2
+	return middle + (x-middle)*s, l.VanishY + h*s
+}
+
+// Unproject is the inverse of Project.
+func (l *Layout) Unproject(x, y float64) (float64, float64) {
+	w := l.Right - l.Left
+	if math.IsInf(l.VanishY, -1) {
+		return (x - l.Left) / w, (l.JudgeY - y) / w
+	}
+
+	h := l.JudgeY - l.VanishY
+	s := max(y-l.VanishY, 1e-6) / h
+	middle := (l.Left + l.Right) / 2
+	lx := middle + (x-middle)/s
+	return (lx - l.Left) / w, (h/s - h) / w
+}
+
+// Scaled returns the layout on the same screen resized by factor f, e.g. a downscaled video stream.
+func (l *Layout) Scaled(f float64) *Layout {
+	return &Layout{
+		Left:    l.Left * f,
+		Right:   l.Right * f,
+		JudgeY:  l.JudgeY * f,
+		VanishY: l.VanishY * f,
+	}
+}
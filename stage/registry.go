@@ -0,0 +1,139 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package stage
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/kvarenzn/ssm/utils"
+)
+
+// LayoutSegment applies to screens whose aspect ratio (width / height) is at most MaxRatio.
+// Lengths are linear functions of the aspect ratio, in screen heights: v[0] + v[1] * ratio
+type LayoutSegment struct {
+	MaxRatio   float64    `json:"maxRatio,omitempty"`   // 0 for no upper bound
+	ClampRatio float64    `json:"clampRatio,omitempty"` // ratio used in the formulas is limited to this, 0 for no limit
+	LaneWidth  [2]float64 `json:"laneWidth"`            // distance between the centers of the outermost lanes
+	JudgeY     [2]float64 `json:"judgeY"`
+}
+
+type LayoutSpec struct {
+	Lanes    int              `json:"lanes"`
+	VanishY  *float64         `json:"vanishY,omitempty"` // in screen heights, omit for a flat stage. The built-in values are estimated, not measured
+	Segments []*LayoutSegment `json:"segments"`
+}
+
+func linear(v [2]float64, ratio float64) float64 {
+	return v[0] + v[1]*ratio
+}
+
+func (s *LayoutSpec) Layout(width, height float64) *Layout {
+	ratio := width / height
+	seg := s.Segments[len(s.Segments)-1]
+	for _, sg := range s.Segments {
+		if sg.MaxRatio == 0 || ratio <= sg.MaxRatio {
+			seg = sg
+			break
+		}
+	}
+
+	if seg.ClampRatio > 0 {
+		ratio = min(ratio, seg.ClampRatio)
+	}
+
+	half := height * linear(seg.LaneWidth, ratio) / 2
+	middle := width / 2
+	layout := &Layout{
+		Left:    middle - half,
+		Right:   middle + half,
+		JudgeY:  height * linear(seg.JudgeY, ratio),
+		VanishY: math.Inf(-1),
+	}
+	if s.VanishY != nil {
+		layout.VanishY = height * *s.VanishY
+	}
+	return layout
+}
+
+// LaneX returns the stage x of the center of the i-th lane.
+func (s *LayoutSpec) LaneX(i int) float64 {
+	if s.Lanes <= 1 {
+		return 0.5
+	}
+
+	return float64(i) / float64(s.Lanes-1)
+}
+
+func (s *LayoutSpec) validate() error {
+	if s.Lanes <= 0 {
+		return fmt.Errorf("lane count must be positive")
+	}
+
+	if len(s.Segments) == 0 {
+		return fmt.Errorf("at least one segment is required")
+	}
+
+	return nil
+}
+
+// 不要问我为什么这里的数字都这么怪
+// 这都是我拿不同尺寸的截图一张张测量完硬凑的
+//
+//go:embed layouts.json
+var builtinLayouts []byte
+
+var layouts = map[string]*LayoutSpec{}
+
+func Register(name string, spec *LayoutSpec) error {
+	if err := spec.validate(); err != nil {
+		return fmt.Errorf("invalid stage layout %q: %w", name, err)
+	}
+
+	layouts[name] = spec
+	return nil
+}
+
+func Get(name string) (*LayoutSpec, bool) {
+	spec, ok := layouts[name]
+	return spec, ok
+}
+
+func Names() []string {
+	return utils.SortedKeysOf(layouts)
+}
+
+func register(data []byte) error {
+	specs := map[string]*LayoutSpec{}
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return err
+	}
+
+	for name, spec := range specs {
+		if err := Register(name, spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load registers every layout in the file at path, replacing built-in layouts with the same name.
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return register(data)
+}
+
+func init() {
+	if err := register(builtinLayouts); err != nil {
+		panic(err)
+	}
+}
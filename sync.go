@@ -0,0 +1,280 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/kvarenzn/ssm/audio"
+	"github.com/kvarenzn/ssm/common"
+	"github.com/kvarenzn/ssm/config"
+	"github.com/kvarenzn/ssm/controllers"
+	"github.com/kvarenzn/ssm/decoders/av"
+	"github.com/kvarenzn/ssm/drift"
+	"github.com/kvarenzn/ssm/log"
+	"github.com/kvarenzn/ssm/stage"
+	"github.com/kvarenzn/ssm/vision"
+)
+
+// frameClock maps the presentation time of frames to the local clock.
+//
+// The clock of the device is unknown, the frame received the fastest is taken as the reference,
+// so the latency of a frame is how much later it arrived than that one.
+// The constant part of the latency (encoding, transfer) is left to the manual offset.
+type frameClock struct {
+	base  time.Time // local time of pts 0
+	valid bool
+}
+
+// observe takes a frame presented at pts and received at the local time, its latency is returned
+func (c *frameClock) observe(pts time.Duration, received time.Time) time.Duration {
+	base := received.Add(-pts)
+	if !c.valid || base.Before(c.base) {
+		c.base = base
+		c.valid = true
+	}
+
+	return received.Sub(c.at(pts))
+}
+
+func (c *frameClock) at(pts time.Duration) time.Time {
+	return c.base.Add(pts)
+}
+
+// syncResult is when a note reaches the judge line, in the local clock
+type syncResult struct {
+	at      time.Time
+	latency time.Duration // of the frame the note was timed in
+}
+
+const (
+	hitBuffer      = 16
+	minScaleChange = 0.00001
+)
+
+// syncFromVideo watches the screen for the first note, then for the notes after it.
+// The first note is sent in the clock of the fastest frame, the others in the clock of the frames they are seen in,
+// so that they tell how the clock of the device runs. Later notes are dropped if the receiver falls behind.
+// Nil is returned if the controller has no video stream.
+func syncFromVideo(ctx context.Context, controller controllers.Controller, dc *config.DeviceConfig, calc stage.LayoutCalculator) <-chan syncResult {
+	sc, ok := controller.(*controllers.ScrcpyController)
+	if !ok || !sc.HasVideo() {
+		return nil
+	}
+
+	spec := getLayoutSpec()
+	long := float64(max(dc.Width, dc.Height))
+	short := float64(min(dc.Width, dc.Height))
+
+	result := make(chan syncResult, hitBuffer)
+	go func() {
+		var clock frameClock
+		var detector *vision.SyncDetector
+		first := true
+		for {
+			var frame *av.Frame
+			select {
+			case <-ctx.Done():
+				return
+			case frame = <-sc.Frames():
+			}
+
+			if frame == nil {
+				return
+			}
+
+			pts := time.Duration(frame.PTS) * time.Microsecond
+			latency := clock.observe(pts, frame.Received)
+
+			bounds := frame.Image.Bounds()
+			if bounds.Dx() < bounds.Dy() {
+				// not in game
+				detector = nil
+				continue
+			}
+
+			if detector == nil || detector.Bounds() != bounds {
+				layout := calc(long, short).Scaled(float64(bounds.Dx()) / long)
+				detector = vision.NewSyncDetector(layout, spec, bounds)
+			}
+
+			at, ok := detector.Feed(pts, frame.Image)
+			if detector.Failed() {
+				if first {
+					log.Debugln("The first note is not timed, waiting for manual start.")
+					return
+				}
+
+				// a note passed the near band first, start over with the next one
+				detector = nil
+				continue
+			}
+
+			if !ok {
+				continue
+			}
+
+			// time the next note with a new detector
+			detector = nil
+			if first {
+				log.Debugf("First note timed at %v (frame %v), latency %v", at, pts, latency)
+				result <- syncResult{at: clock.at(at), latency: latency}
+				first = false
+				continue
+			}
+
+			select {
+			case result <- syncResult{at: frame.Received.Add(at - pts), latency: latency}:
+			default:
+			}
+		}
+	}()
+
+	return result
+}
+
+// alignInterval is how much audio is captured between two alignments
+const alignInterval = 500 * time.Millisecond
+
+// audioAlignment is when the chart starts (its time 0) in the local clock, as heard in the audio
+type audioAlignment struct {
+	start time.Time
+	score float64
+
+	// the chart was at this time when the latest audio was received, this tells how the clock of the device runs
+	heard time.Time
+	chart time.Duration
+}
+
+// noteTimes returns the time of each touch down of the chart
+func noteTimes(rawEvents common.RawVirtualEvents) []time.Duration {
+	times := []time.Duration{}
+	for _, item := range rawEvents {
+		for _, event := range item.Events {
+			if event.Action == common.TouchDown {
+				times = append(times, time.Duration(item.Timestamp)*time.Millisecond)
+				break
+			}
+		}
+	}
+	return times
+}
+
+// audioReference returns the onset envelope the audio of the device is aligned with:
+// the one of the song audio given with `-x`, or the clicks of the notes of the chart
+func audioReference(notes []time.Duration) []float64 {
+	if referencePath == "" {
+		return audio.ClickTrack(notes)
+	}
+
+	clip, err := audio.LoadWAV(referencePath)
+	if err != nil {
+		log.Die("Failed to load the song audio:", err)
+	}
+	return clip.Envelope()
+}
+
+// syncFromAudio aligns the audio of the device with the reference, every confident alignment is sent
+// and replaces the one not yet received. Nil is returned if the controller has no audio stream.
+func syncFromAudio(ctx context.Context, controller controllers.Controller, reference []float64) <-chan audioAlignment {
+	sc, ok := controller.(*controllers.ScrcpyController)
+	if !ok || !sc.HasAudio() || len(reference) == 0 {
+		return nil
+	}
+
+	result := make(chan audioAlignment, 1)
+	go func() {
+		var clock frameClock
+		aligner := audio.NewAligner(reference)
+		next := time.Duration(0)
+		for {
+			var frame *av.AudioFrame
+			select {
+			case <-ctx.Done():
+				return
+			case frame = <-sc.Audio():
+			}
+
+			if frame == nil {
+				return
+			}
+
+			pts := time.Duration(frame.PTS) * time.Microsecond
+			clock.observe(pts, frame.Received)
+			aligner.Write(pts, frame.SampleRate, frame.Samples)
+			if pts < next {
+				continue
+			}
+			next = pts + alignInterval
+
+			alignment, ok := aligner.Align()
+			if !ok || !alignment.Confident() {
+				continue
+			}
+
+			log.Debugf("Audio aligned: chart starts at %v, score %.2f, margin %.2f", alignment.Start, alignment.Score, alignment.Margin)
+			select {
+			case <-result:
+			default:
+			}
+			end := pts + time.Duration(len(frame.Samples))*time.Second/time.Duration(frame.SampleRate)
+			result <- audioAlignment{
+				start: clock.at(alignment.Start),
+				score: alignment.Score,
+				heard: frame.Received,
+				chart: end - alignment.Start,
+			}
+		}
+	}()
+
+	return result
+}
+
+// watchDrift estimates the scale from the notes seen in the video and the alignments of the audio during the play
+func (t *tui) watchDrift(ctx context.Context, sync <-chan syncResult, aligned <-chan audioAlignment) {
+	if sync == nil && aligned == nil {
+		return
+	}
+
+	var estimator *drift.Estimator
+	var anchor time.Time
+	for {
+		var at time.Time
+		var chart time.Duration
+		select {
+		case <-ctx.Done():
+			return
+		case result := <-sync:
+			note, ok := t.session.NearestNote(result.at)
+			if !ok {
+				continue
+			}
+			at, chart = result.at, note
+		case alignment := <-aligned:
+			at, chart = alignment.heard, alignment.chart
+		}
+
+		// hits before a pause or a seek are not comparable with the ones after
+		if a := t.session.Anchor(); estimator == nil || !a.Equal(anchor) {
+			estimator = drift.NewEstimator()
+			anchor = a
+		}
+		estimator.Observe(at.Sub(anchor), chart)
+
+		if !t.session.AutoScale() {
+			continue
+		}
+
+		estimate, ok := estimator.Estimate()
+		if !ok || math.Abs(estimate.Scale-t.session.Scale()) < minScaleChange {
+			continue
+		}
+
+		log.Debugf("Speed estimated: %+.3f%% from %d hits (residual %v)", (estimate.Scale-1)*100, estimate.Hits, estimate.Residual)
+		// the drift since the anchor is corrected as well, the fitted offset is left out (see Session.EstimateScale)
+		t.session.EstimateScale(estimate.Scale, estimate.Hits)
+	}
+}
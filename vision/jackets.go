@@ -0,0 +1,126 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vision
+
+import (
+	"encoding/json"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"slices"
+
+	"github.com/kvarenzn/ssm/db"
+	"github.com/kvarenzn/ssm/log"
+)
+
+// MaxJacketDistance is the largest hamming distance between the hashes of two pictures of the same jacket
+const MaxJacketDistance = 12
+
+type jacketEntry struct {
+	SongID int  `json:"id"`
+	Hash   Hash `json:"hash"`
+}
+
+// JacketIndex finds songs by the perceptual hashes of their jackets
+type JacketIndex struct {
+	entries []jacketEntry
+}
+
+func NewJacketIndex() *JacketIndex {
+	return &JacketIndex{}
+}
+
+// LoadJacketIndex loads an index saved by Save
+func LoadJacketIndex(path string) (*JacketIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &JacketIndex{}
+	if err := json.Unmarshal(data, &index.entries); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (i *JacketIndex) Save(path string) error {
+	data, err := json.Marshal(i.entries)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (i *JacketIndex) Len() int {
+	return len(i.entries)
+}
+
+func (i *JacketIndex) Add(songID int, jacket image.Image) {
+	i.entries = append(i.entries, jacketEntry{
+		SongID: songID,
+		Hash:   PHash(jacket),
+	})
+}
+
+func (i *JacketIndex) has(songID int) bool {
+	return slices.ContainsFunc(i.entries, func(e jacketEntry) bool {
+		return e.SongID == songID
+	})
+}
+
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// Update hashes the extracted jackets of the songs in database that are not indexed yet,
+// songs without an extracted jacket are skipped. It returns the number of songs added.
+func (i *JacketIndex) Update(database db.MusicDatabase) int {
+	added := 0
+	for _, id := range database.IDs() {
+		if i.has(id) {
+			continue
+		}
+
+		thumb, jacket := database.Jacket(id)
+		if jacket == "" {
+			continue
+		}
+
+		img, err := decodeImageFile(jacket)
+		if err != nil {
+			img, err = decodeImageFile(thumb)
+		}
+		if err != nil {
+			log.Debugf("Failed to load jacket of song %d: %s", id, err)
+			continue
+		}
+
+		i.Add(id, img)
+		added++
+	}
+	return added
+}
+
+// Match returns the song whose jacket looks the most like img
+func (i *JacketIndex) Match(img image.Image) (songID int, distance int, ok bool) {
+	h := PHash(img)
+	distance = MaxJacketDistance + 1
+	for _, e := range i.entries {
+		if d := h.Distance(e.Hash); d < distance {
+			songID, distance = e.SongID, d
+		}
+	}
+
+	return songID, distance, distance <= MaxJacketDistance
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vision
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	hashInputSize = 32
+	hashSize      = 8
+)
+
+// Hash is a 64-bit perceptual hash, similar images have hashes with a small hamming distance
+type Hash uint64
+
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "%016x", uint64(h)), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return err
+	}
+
+	*h = Hash(v)
+	return nil
+}
+
+var dctTable = func() [hashSize][hashInputSize]float64 {
+	var table [hashSize][hashInputSize]float64
+	for u := range hashSize {
+		for x := range hashInputSize {
+			table[u][x] = math.Cos(float64((2*x+1)*u) * math.Pi / (2 * hashInputSize))
+		}
+	}
+	return table
+}()
+
+// PHash computes the DCT based perceptual hash of img:
+// the image is shrunk to 32x32 grayscale, and each of the 8x8 lowest frequencies becomes a bit,
+// set if it is greater than the median of them (the DC term excluded).
+//
+// ref: http://www.hackerfactor.com/blog/index.php?/archives/432-Looks-Like-It.html
+func PHash(img image.Image) Hash {
+	small := image.NewGray(image.Rect(0, 0, hashInputSize, hashInputSize))
+	draw.BiLinear.Scale(small, small.Rect, img, img.Bounds(), draw.Src, nil)
+
+	// separable 2D DCT-II, only the low frequencies are needed
+	var rows [hashInputSize][hashSize]float64
+	for y := range hashInputSize {
+		line := small.Pix[y*small.Stride:]
+		for v := range hashSize {
+			sum := 0.0
+			for x := range hashInputSize {
+				sum += float64(line[x]) * dctTable[v][x]
+			}
+			rows[y][v] = sum
+		}
+	}
+
+	var coefficients [hashSize * hashSize]float64
+	for u := range hashSize {
+		for v := range hashSize {
+			sum := 0.0
+			for y := range hashInputSize {
+				sum += rows[y][v] * dctTable[u][y]
+			}
+			coefficients[u*hashSize+v] = sum
+		}
+	}
+
+	sorted := slices.Clone(coefficients[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var h Hash
+	for i, c := range coefficients {
+		if c > median {
+			h |= 1 << i
+		}
+	}
+	return h
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vision
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"slices"
+
+	"github.com/kvarenzn/ssm/utils"
+)
+
+// Region is a rectangle on the game UI, in fractions of the largest 16:9 area centered on the screen,
+// which is where both games lay out their menus.
+type Region struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
+}
+
+// uiArea returns the largest 16:9 area centered on a screen of the given size
+func uiArea(width, height float64) (left, top, uiWidth, uiHeight float64) {
+	uiWidth, uiHeight = width, height
+	if width*9 > height*16 {
+		uiWidth = height * 16 / 9
+	} else {
+		uiHeight = width * 9 / 16
+	}
+
+	return (width - uiWidth) / 2, (height - uiHeight) / 2, uiWidth, uiHeight
+}
+
+// In returns the pixels covered by the region on a screen with the given bounds
+func (r Region) In(bounds image.Rectangle) image.Rectangle {
+	left, top, uiWidth, uiHeight := uiArea(float64(bounds.Dx()), float64(bounds.Dy()))
+	left += float64(bounds.Min.X)
+	top += float64(bounds.Min.Y)
+	return image.Rect(
+		int(left+r.X*uiWidth+0.5),
+		int(top+r.Y*uiHeight+0.5),
+		int(left+(r.X+r.W)*uiWidth+0.5),
+		int(top+(r.Y+r.H)*uiHeight+0.5),
+	).Intersect(bounds)
+}
+
+// Point is a position on the game UI, in the same unit as Region
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// In returns the position in pixels on a landscape screen of the given size
+func (p Point) In(width, height float64) (float64, float64) {
+	left, top, uiWidth, uiHeight := uiArea(width, height)
+	return left + p.X*uiWidth, top + p.Y*uiHeight
+}
+
+// Color is a "#rrggbb" color in JSON
+type Color color.RGBA
+
+func (c Color) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "#%02x%02x%02x", c.R, c.G, c.B), nil
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(string(text), "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return fmt.Errorf("invalid color %q: %w", text, err)
+	}
+
+	*c = Color{R: r, G: g, B: b, A: 0xff}
+	return nil
+}
+
+// ScreenSpec describes where things are on the screens of a game
+type ScreenSpec struct {
+	// song selection screen
+	Jacket       Region           `json:"jacket"`       // jacket of the selected song
+	Badge        Region           `json:"badge"`        // a part of the badge of the selected difficulty, filled with its color
+	Difficulties map[string]Color `json:"difficulties"` // badge colors, keyed by the names taken by `-d`
+
+	States map[ScreenState][]*Probe `json:"states"` // a screen is in a state if all of its probes match
+	Taps   map[string]Point         `json:"taps"`   // buttons, see the Tap* constants
+
+	builtin bool
+}
+
+// Builtin reports whether the spec is the built-in one, whose states and taps are unmeasured placeholders
+func (s *ScreenSpec) Builtin() bool {
+	return s.builtin
+}
+
+func (s *ScreenSpec) validate() error {
+	for name, r := range map[string]Region{"jacket": s.Jacket, "badge": s.Badge} {
+		if r.W <= 0 || r.H <= 0 {
+			return fmt.Errorf("%s region must not be empty", name)
+		}
+	}
+
+	if len(s.Difficulties) == 0 {
+		return fmt.Errorf("at least one difficulty color is required")
+	}
+
+	for state, probes := range s.States {
+		if !slices.Contains(screenStates, state) {
+			return fmt.Errorf("unknown screen state %q", state)
+		}
+
+		if len(probes) == 0 {
+			return fmt.Errorf("state %q has no probes", state)
+		}
+
+		for _, p := range probes {
+			if p.W <= 0 || p.H <= 0 {
+				return fmt.Errorf("probe of state %q must not be empty", state)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 默认值是按16:9的截图估计的，不准的话请在screens.json中自行调整
+// 其中的states和taps是占位值，还没有用真实截图验证过，因此连续演奏(-t)只使用screens.json中的配置
+//
+//go:embed screens.json
+var builtinScreens []byte
+
+var screens = map[string]*ScreenSpec{}
+
+func Register(name string, spec *ScreenSpec) error {
+	if err := spec.validate(); err != nil {
+		return fmt.Errorf("invalid screen spec %q: %w", name, err)
+	}
+
+	spec.builtin = false
+	screens[name] = spec
+	return nil
+}
+
+func Get(name string) (*ScreenSpec, bool) {
+	spec, ok := screens[name]
+	return spec, ok
+}
+
+func Names() []string {
+	return utils.SortedKeysOf(screens)
+}
+
+func register(data []byte) error {
+	specs := map[string]*ScreenSpec{}
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return err
+	}
+
+	for name, spec := range specs {
+		if err := Register(name, spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load registers every screen spec in the file at path, replacing built-in specs with the same name.
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return register(data)
+}
+
+func init() {
+	if err := register(builtinScreens); err != nil {
+		panic(err)
+	}
+
+	for _, spec := range screens {
+		spec.builtin = true
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vision
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"slices"
+
+	"github.com/kvarenzn/ssm/utils"
+)
+
+// maxColorDistance is the largest squared RGB distance from a badge to the color of its difficulty
+const maxColorDistance = 80 * 80
+
+var (
+	ErrJacketNotFound     = errors.New("no known jacket on the screen")
+	ErrDifficultyNotFound = errors.New("no known difficulty badge on the screen")
+)
+
+// Selection is the song and difficulty selected on the song selection screen
+type Selection struct {
+	SongID     int
+	Difficulty string
+	Distance   int // hamming distance between the jacket on the screen and the indexed one
+}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+func crop(img image.Image, r Region) image.Image {
+	rect := r.In(img.Bounds())
+	if s, ok := img.(subImager); ok {
+		return s.SubImage(rect)
+	}
+
+	result := image.NewRGBA(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			result.Set(x, y, img.At(x, y))
+		}
+	}
+	return result
+}
+
+// medianColor is robust against the text printed on the badge
+func medianColor(img image.Image) color.RGBA {
+	bounds := img.Bounds()
+	var r, g, b []uint8
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			r = append(r, c.R)
+			g = append(g, c.G)
+			b = append(b, c.B)
+		}
+	}
+
+	if len(r) == 0 {
+		return color.RGBA{}
+	}
+
+	median := func(v []uint8) uint8 {
+		slices.Sort(v)
+		return v[len(v)/2]
+	}
+	return color.RGBA{R: median(r), G: median(g), B: median(b), A: 0xff}
+}
+
+// ClassifyDifficulty returns the difficulty whose color is the closest to the badge on the screen
+func (s *ScreenSpec) ClassifyDifficulty(screen image.Image) (string, bool) {
+	c := medianColor(crop(screen, s.Badge))
+
+	best, bestDistance := "", maxColorDistance+1
+	// sorted, so that ties are broken the same way every time
+	for _, name := range utils.SortedKeysOf(s.Difficulties) {
+		d := s.Difficulties[name]
+		dr, dg, db := int(c.R)-int(d.R), int(c.G)-int(d.G), int(c.B)-int(d.B)
+		if distance := dr*dr + dg*dg + db*db; distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+
+	return best, bestDistance <= maxColorDistance
+}
+
+// MatchJacket returns the song whose jacket is shown on the song selection screen
+func (s *ScreenSpec) MatchJacket(screen image.Image, jackets *JacketIndex) (songID int, distance int, ok bool) {
+	return jackets.Match(crop(screen, s.Jacket))
+}
+
+// RecognizeSelection reads the selected song and difficulty from a screenshot of the song selection screen
+func (s *ScreenSpec) RecognizeSelection(screen image.Image, jackets *JacketIndex) (*Selection, error) {
+	songID, distance, ok := s.MatchJacket(screen, jackets)
+	if !ok {
+		return nil, ErrJacketNotFound
+	}
+
+	difficulty, ok := s.ClassifyDifficulty(screen)
+	if !ok {
+		return nil, ErrDifficultyNotFound
+	}
+
+	return &Selection{
+		SongID:     songID,
+		Difficulty: difficulty,
+		Distance:   distance,
+	}, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vision
+
+import (
+	"image"
+)
+
+// ScreenState is what the game is showing
+type ScreenState string
+
+const (
+	StateUnknown     ScreenState = "unknown"
+	StateSelect      ScreenState = "select"       // song selection
+	StateLiveSetting ScreenState = "live-setting" // confirmation before the live, e.g. choosing the band
+	StateLoading     ScreenState = "loading"
+	StatePlaying     ScreenState = "playing"
+	StateResult      ScreenState = "result"
+	StateDialog      ScreenState = "dialog" // any popup with a confirm button, e.g. rewards and notices
+)
+
+// screenStates in the order they are checked, popups first as they are drawn on top of the other screens
+var screenStates = []ScreenState{
+	StateDialog,
+	StateResult,
+	StateLiveSetting,
+	StateSelect,
+	StateLoading,
+	StatePlaying,
+}
+
+// Names of the buttons in ScreenSpec.Taps
+const (
+	TapSelectStart = "select.start" // start the selected song
+	TapSelectNext  = "select.next"  // select the next song in the list
+	TapLiveStart   = "live.start"
+	TapResultNext  = "result.next" // leave the result screens
+	TapDialogOK    = "dialog.ok"
+)
+
+const defaultProbeTolerance = 48
+
+// Probe checks the color of a part of the screen
+type Probe struct {
+	Region
+	Color     Color `json:"color"`
+	Tolerance int   `json:"tolerance,omitempty"` // largest RGB distance to Color, 48 if 0
+}
+
+func (p *Probe) Match(screen image.Image) bool {
+	c := medianColor(crop(screen, p.Region))
+
+	tolerance := p.Tolerance
+	if tolerance == 0 {
+		tolerance = defaultProbeTolerance
+	}
+
+	dr, dg, db := int(c.R)-int(p.Color.R), int(c.G)-int(p.Color.G), int(c.B)-int(p.Color.B)
+	return dr*dr+dg*dg+db*db <= tolerance*tolerance
+}
+
+// Classify tells which screen is shown, StateUnknown if none of the states match
+func (s *ScreenSpec) Classify(screen image.Image) ScreenState {
+	if b := screen.Bounds(); b.Dx() < b.Dy() {
+		// both games are played in landscape
+		return StateUnknown
+	}
+
+	for _, state := range screenStates {
+		probes := s.States[state]
+		if len(probes) == 0 {
+			continue
+		}
+
+		matched := true
+		for _, p := range probes {
+			if !p.Match(screen) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return state
+		}
+	}
+
+	return StateUnknown
+}
+
+// Tap returns the position of a button in pixels on a landscape screen of the given size
+func (s *ScreenSpec) Tap(name string, width, height float64) (float64, float64, bool) {
+	p, ok := s.Taps[name]
+	if !ok {
+		return 0, 0, false
+	}
+
+	x, y := p.In(width, height)
+	return x, y, true
+}
@@ -0,0 +1,167 @@
+// Copyright (C) 2024, 2025 kvarenzn
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package vision
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/kvarenzn/ssm/stage"
+)
+
+const (
+	syncThreshold = 32 // change of luma that counts as a note
+
+	// depths of the bands, in fractions of the depth of the top edge of the screen,
+	// notes are timed with about 1/5 of their way left, earlier than any video stream latency
+	syncFarBand   = 0.5
+	syncNearBand  = 0.2
+	syncBandWidth = 0.04
+)
+
+// band watches a strip across the lanes for notes
+type band struct {
+	depth    float64 // where a note enters the band
+	samples  []image.Rectangle
+	previous [][]uint8
+}
+
+func newBand(layout *stage.Layout, spec *stage.LayoutSpec, bounds image.Rectangle, depth, width float64) *band {
+	halfLane := 0.3
+	if spec.Lanes > 1 {
+		halfLane /= float64(spec.Lanes - 1)
+	}
+
+	b := &band{depth: depth + width}
+	for i := range spec.Lanes {
+		lane := spec.LaneX(i)
+		left, bottom := layout.Project(lane-halfLane, depth)
+		right, _ := layout.Project(lane+halfLane, depth)
+		_, top := layout.Project(lane, depth+width)
+
+		if rect := image.Rect(int(left), int(top), int(right), int(bottom)).Intersect(bounds); !rect.Empty() {
+			b.samples = append(b.samples, rect)
+		}
+	}
+
+	b.previous = make([][]uint8, len(b.samples))
+	return b
+}
+
+func lumaOf(img image.Image, r image.Rectangle, dst []uint8) []uint8 {
+	dst = dst[:0]
+	if ycc, ok := img.(*image.YCbCr); ok {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			offset := ycc.YOffset(r.Min.X, y)
+			dst = append(dst, ycc.Y[offset:offset+r.Dx()]...)
+		}
+		return dst
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dst = append(dst, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return dst
+}
+
+// changed reports whether most of a row of the sample differs from the previous frame, as a note spans the whole lane
+func changed(previous, current []uint8, width int) bool {
+	for row := 0; row+width <= len(current); row += width {
+		count := 0
+		for i := row; i < row+width; i++ {
+			if int(current[i])-int(previous[i]) > syncThreshold || int(previous[i])-int(current[i]) > syncThreshold {
+				count++
+			}
+		}
+
+		if count*2 >= width {
+			return true
+		}
+	}
+	return false
+}
+
+// feed reports whether a note showed up in the band.
+// Changes in most of the lanes at once are transitions of the whole screen, not notes.
+func (b *band) feed(img image.Image) bool {
+	count := 0
+	for i, r := range b.samples {
+		current := lumaOf(img, r, nil)
+		if b.previous[i] != nil && changed(b.previous[i], current, r.Dx()) {
+			count++
+		}
+		b.previous[i] = current
+	}
+
+	return count > 0 && count <= len(b.samples)/2
+}
+
+// SyncDetector finds when the first note of the song reaches the judge line from the video of the screen.
+//
+// A note is timed when it enters a band far up the lanes and another one near the judge line,
+// the rest of its way is extrapolated, so the result is known before the note actually gets there.
+type SyncDetector struct {
+	bounds    image.Rectangle
+	far, near *band
+
+	farPTS  time.Duration
+	farSeen bool
+	failed  bool
+}
+
+// NewSyncDetector creates a detector for frames with the given bounds, layout should be computed for the same size
+func NewSyncDetector(layout *stage.Layout, spec *stage.LayoutSpec, bounds image.Rectangle) *SyncDetector {
+	_, top := layout.Unproject((layout.Left+layout.Right)/2, float64(bounds.Min.Y))
+
+	return &SyncDetector{
+		bounds: bounds,
+		far:    newBand(layout, spec, bounds, top*syncFarBand, top*syncBandWidth),
+		near:   newBand(layout, spec, bounds, top*syncNearBand, top*syncBandWidth),
+	}
+}
+
+func (d *SyncDetector) Bounds() image.Rectangle {
+	return d.bounds
+}
+
+// Failed reports whether a note showed up near the judge line before the far band, the first note can not be timed then
+func (d *SyncDetector) Failed() bool {
+	return d.failed
+}
+
+// Feed takes the frames in order with their presentation time.
+// Once the first note is timed, it returns the moment the note reaches the judge line, in the clock of pts.
+func (d *SyncDetector) Feed(pts time.Duration, img image.Image) (time.Duration, bool) {
+	if d.failed || len(d.far.samples) == 0 || len(d.near.samples) == 0 {
+		return 0, false
+	}
+
+	if !d.farSeen {
+		if d.near.feed(img) {
+			d.failed = true
+			return 0, false
+		}
+
+		d.farSeen = d.far.feed(img)
+		d.farPTS = pts
+		return 0, false
+	}
+
+	if !d.near.feed(img) {
+		return 0, false
+	}
+
+	// the notes move down the lanes at a constant speed in stage depth
+	elapsed := pts - d.farPTS
+	if elapsed <= 0 {
+		d.failed = true
+		return 0, false
+	}
+
+	remaining := time.Duration(float64(elapsed) * d.near.depth / (d.far.depth - d.near.depth))
+	return pts + remaining, true
+}
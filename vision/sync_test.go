@@ -0,0 +1,73 @@
+package vision_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+
+	"github.com/kvarenzn/ssm/stage"
+	"github.com/kvarenzn/ssm/vision"
+)
+
+// drawStage renders a dark stage with the given brightness, and a note in the 3rd lane at depth if depth >= 0
+func drawStage(layout *stage.Layout, bounds image.Rectangle, brightness uint8, depth float64) *image.Gray {
+	img := image.NewGray(bounds)
+	draw.Draw(img, bounds, &image.Uniform{color.Gray{Y: brightness}}, image.Point{}, draw.Src)
+	if depth < 0 {
+		return img
+	}
+
+	const lane, halfWidth, length = 2.0 / 6, 0.07, 0.03
+	x0, y0 := layout.Project(lane-halfWidth, depth+length)
+	x1, y1 := layout.Project(lane+halfWidth, depth)
+	draw.Draw(img, image.Rect(int(x0), int(y0), int(x1), int(y1)), &image.Uniform{color.Gray{Y: 240}}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestSyncDetector(t *testing.T) {
+	spec, _ := stage.Get("bang")
+	bounds := image.Rect(0, 0, 960, 540)
+	layout := spec.Layout(960, 540)
+	_, top := layout.Unproject((layout.Left+layout.Right)/2, 0)
+
+	const frame = time.Second / 60
+	hit := 2 * time.Second // the note reaches the judge line
+	travel := 800 * time.Millisecond
+
+	detector := vision.NewSyncDetector(layout, spec, bounds)
+	for pts := time.Duration(0); pts < hit; pts += frame {
+		var img *image.Gray
+		switch {
+		case pts < 500*time.Millisecond:
+			img = drawStage(layout, bounds, 0, -1)
+		case pts < hit-travel:
+			// the stage fades in
+			img = drawStage(layout, bounds, 60, -1)
+		default:
+			depth := top * float64(hit-pts) / float64(travel)
+			img = drawStage(layout, bounds, 60, depth)
+		}
+
+		at, ok := detector.Feed(pts, img)
+		if detector.Failed() {
+			t.Fatalf("Detector failed at %v", pts)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if pts > hit-100*time.Millisecond {
+			t.Errorf("Expected the note to be timed well before it reaches the judge line, but it was timed at %v", pts)
+		}
+
+		if diff := (at - hit).Abs(); diff > 2*frame {
+			t.Errorf("Expected the note at %v, but got %v", hit, at)
+		}
+		return
+	}
+
+	t.Error("The note is never detected")
+}
@@ -0,0 +1,198 @@
+package vision_test
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kvarenzn/ssm/vision"
+)
+
+func loadPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// testdata/jackets/<song id>.png stand in for the extracted jackets, and the other files for screenshots
+// of the song selection screen, with the jackets and the badges drawn in the built-in regions and colors.
+// They are synthetic: the regions and the colors have not been measured on the games yet.
+func loadJacketIndex(t *testing.T) *vision.JacketIndex {
+	t.Helper()
+
+	paths, err := filepath.Glob("testdata/jackets/*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := vision.NewJacketIndex()
+	for _, path := range paths {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.Add(id, loadPNG(t, path))
+	}
+	return index
+}
+
+func TestRecognizeSelection(t *testing.T) {
+	index := loadJacketIndex(t)
+
+	for _, tc := range []struct {
+		screen     string
+		game       string
+		songID     int
+		difficulty string
+	}{
+		{"bang_42_expert.png", "bang", 42, "expert"},
+		{"bang_128_normal_4x3.png", "bang", 128, "normal"},
+		{"pjsk_301_master.png", "pjsk", 301, "master"},
+	} {
+		t.Run(tc.screen, func(t *testing.T) {
+			spec, ok := vision.Get(tc.game)
+			if !ok {
+				t.Fatalf("Screen spec %q not found", tc.game)
+			}
+
+			selection, err := spec.RecognizeSelection(loadPNG(t, filepath.Join("testdata", tc.screen)), index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if selection.SongID != tc.songID || selection.Difficulty != tc.difficulty {
+				t.Errorf("Expected song %d (%s), but got song %d (%s)", tc.songID, tc.difficulty, selection.SongID, selection.Difficulty)
+			}
+		})
+	}
+}
+
+func TestRecognizeUnknownJacket(t *testing.T) {
+	spec, _ := vision.Get("bang")
+	_, err := spec.RecognizeSelection(loadPNG(t, "testdata/bang_unknown.png"), loadJacketIndex(t))
+	if !errors.Is(err, vision.ErrJacketNotFound) {
+		t.Errorf("Expected ErrJacketNotFound, but got %v", err)
+	}
+}
+
+func TestJacketIndexSaveLoad(t *testing.T) {
+	index := loadJacketIndex(t)
+	path := filepath.Join(t.TempDir(), "jackets.json")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := vision.LoadJacketIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != index.Len() {
+		t.Fatalf("Expected %d jackets, but got %d", index.Len(), loaded.Len())
+	}
+
+	id, distance, ok := loaded.Match(loadPNG(t, "testdata/jackets/42.png"))
+	if !ok || id != 42 || distance != 0 {
+		t.Errorf("Expected song 42 at distance 0, but got song %d at distance %d", id, distance)
+	}
+}
+
+func TestRegion(t *testing.T) {
+	r := vision.Region{X: 0.25, Y: 0.5, W: 0.5, H: 0.25}
+	for _, tc := range []struct {
+		bounds   image.Rectangle
+		expected image.Rectangle
+	}{
+		{image.Rect(0, 0, 1600, 900), image.Rect(400, 450, 1200, 675)},
+		{image.Rect(0, 0, 2400, 900), image.Rect(800, 450, 1600, 675)},  // pillarboxed
+		{image.Rect(0, 0, 1600, 1200), image.Rect(400, 600, 1200, 825)}, // letterboxed
+	} {
+		if got := r.In(tc.bounds); got != tc.expected {
+			t.Errorf("Expected %v on %v, but got %v", tc.expected, tc.bounds, got)
+		}
+	}
+}
+
+// testdata/states/<layout>_<state>.png are synthetic, painted with the colors of the built-in probes.
+// They only check that Classify follows the specs, the built-in states are unverified placeholders
+// until they are replaced with real (downscaled) screenshots of the games.
+func TestClassify(t *testing.T) {
+	paths, err := filepath.Glob("testdata/states/*_*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) == 0 {
+		t.Fatal("No screenshot found")
+	}
+
+	for _, path := range paths {
+		name, state, _ := strings.Cut(strings.TrimSuffix(filepath.Base(path), ".png"), "_")
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			spec, ok := vision.Get(name)
+			if !ok {
+				t.Fatalf("Screen spec %q not found", name)
+			}
+
+			if got := spec.Classify(loadPNG(t, path)); got != vision.ScreenState(state) {
+				t.Errorf("Expected %s, but got %s", state, got)
+			}
+		})
+	}
+}
+
+func TestClassifyPortrait(t *testing.T) {
+	spec, _ := vision.Get("bang")
+	if got := spec.Classify(loadPNG(t, "testdata/states/portrait.png")); got != vision.StateUnknown {
+		t.Errorf("Expected %s, but got %s", vision.StateUnknown, got)
+	}
+}
+
+func TestTap(t *testing.T) {
+	spec, _ := vision.Get("bang")
+	for _, name := range []string{vision.TapSelectStart, vision.TapSelectNext, vision.TapLiveStart, vision.TapResultNext, vision.TapDialogOK} {
+		x, y, ok := spec.Tap(name, 2400, 1080)
+		if !ok {
+			t.Errorf("Tap target %s not found", name)
+			continue
+		}
+
+		// the 16:9 area of a 2400x1080 screen starts at x = 240
+		if x < 240 || x > 2160 || y < 0 || y > 1080 {
+			t.Errorf("Tap target %s is out of the screen: (%.1f, %.1f)", name, x, y)
+		}
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	for _, name := range []string{"bang", "pjsk"} {
+		if spec, _ := vision.Get(name); !spec.Builtin() {
+			t.Errorf("Spec %q is not built-in", name)
+		}
+	}
+
+	// a spec of the user, e.g. loaded from screens.json
+	builtin, _ := vision.Get("bang")
+	spec := *builtin
+	if err := vision.Register("measured", &spec); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := vision.Get("measured"); got.Builtin() {
+		t.Error("Registered spec is built-in")
+	}
+}